@@ -1,22 +1,38 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html/template"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
+	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/smtp"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 )
 
 const (
@@ -29,90 +45,258 @@ const (
 var perfTestKeywords = []string{"browsertime", "talos", "perftest", "awsy"}
 
 var (
-	threshold int
-	daysBack  int
+	threshold     int
+	daysBack      int
+	crossCheck    bool
+	checkReopened bool
+	groupBy       string
+	// thresholdPercentile, when set, replaces threshold with that percentile
+	// of the run's failure counts.
+	thresholdPercentile float64
+	// minBugsPerComponent rolls smaller component sections into "Other".
+	minBugsPerComponent int
+	// bugPageSize is the number of bugs requested per Bugzilla search page.
+	bugPageSize = 1000
+	// sortKey orders the analyzed results: failures, per-day, id, assignee
+	// or summary.
+	sortKey = "failures"
+	// quiet suppresses the progress counter, e.g. for cron runs.
+	quiet bool
+	// lang selects the locale of the report's fixed labels.
+	lang = "en"
+	// excludeLinkedTo drops searched bugs that are duplicates of, block or
+	// depend on this meta bug (0 = keep everything).
+	excludeLinkedTo int
+	// prettyJSON indents --format json output for reading; it is compact
+	// otherwise, for machines.
+	prettyJSON bool
+	// gzipJSON compresses --format json output, which gets large for long
+	// multi-product windows.
+	gzipJSON bool
 )
 
 var (
 	maxConcurrent  int
 	bugzillaBase   = BugzillaURL
 	treeherderBase = TreeherderURL
+	displayLoc     = time.UTC
+	repoOrder      []string
+	countTrees     []string
+	logoURL        string
+	accentColor    string
+	// runCtx is cancelled when --max-runtime elapses; timeLimited records
+	// that the report was cut short.
+	runCtx      = context.Background()
+	timeLimited bool
+	// truncatedFrom is the number of intermittents before --top cut the
+	// list, or 0 when it wasn't cut.
+	truncatedFrom int
+	// hiddenNeedinfo counts bugs dropped by --hide-needinfo.
+	hiddenNeedinfo int
+	// failedSearches names the Bugzilla searches that failed, so the
+	// report says which of its sections are missing.
+	failedSearches []string
+	// failureStats describes the failure counts of all reported intermittents.
+	failureStats FailureStats
+	// triageOwners maps component name to its Bugzilla triage owner.
+	triageOwners map[string]string
+	// bugzillaAPIKey authenticates Bugzilla requests for higher rate limits.
+	bugzillaAPIKey string
+	// cacheDir holds cached Bugzilla metadata and Treeherder responses;
+	// empty disables caching. The Treeherder cache is opt-in through
+	// treeherderCache, and noCache overrides it.
+	cacheDir        string
+	treeherderCache bool
+	noCache         bool
+	metadataTTL     time.Duration
+	refreshMetadata bool
 )
 
 //go:embed template.html
 var reportTemplate string
 
+// htmlTemplate is the template writeHTMLReport renders: the embedded one, or
+// the file given to --template.
+var htmlTemplate = reportTemplate
+
+// runbooks maps summary glob patterns to remediation docs, loaded from --runbooks.
+var runbooks []runbook
+
+type runbook struct {
+	Pattern *regexp.Regexp
+	URL     string
+}
+
+// bugFields is the include_fields list shared by every bug search.
+const bugFields = "id,summary,component,creation_time,flags,assigned_to,keywords,comment_count,qa_contact,dupe_of,blocks,depends_on,priority,whiteboard"
+
+// products are the Bugzilla products searched; Bugzilla ORs repeated
+// product params.
+var products = []string{"Testing"}
+
 var components = []string{"AWSY", "Condprofile", "mozperftest", "Performance", "Raptor", "Talos"}
 
 type Bug struct {
-	ID           int    `json:"id"`
-	Summary      string `json:"summary"`
-	Component    string `json:"component"`
-	CreationTime string `json:"creation_time"`
-	Flags        []struct {
-		Name      string `json:"name"`
-		Requestee string `json:"requestee"`
-	} `json:"flags,omitempty"`
-	AssignedTo string `json:"assigned_to"`
+	ID           int      `json:"id"`
+	Summary      string   `json:"summary"`
+	Component    string   `json:"component"`
+	CreationTime string   `json:"creation_time"`
+	Flags        []Flag   `json:"flags,omitempty"`
+	AssignedTo   string   `json:"assigned_to"`
+	Keywords     []string `json:"keywords,omitempty"`
+	CommentCount int      `json:"comment_count"`
+	QAContact    string   `json:"qa_contact"`
+	DupeOf       int      `json:"dupe_of,omitempty"`
+	Blocks       []int    `json:"blocks,omitempty"`
+	DependsOn    []int    `json:"depends_on,omitempty"`
+	Priority     string   `json:"priority"`
+	Whiteboard   string   `json:"whiteboard"`
+}
+
+type Flag struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	Requestee    string `json:"requestee"`
+	Setter       string `json:"setter"`
+	CreationDate string `json:"creation_date"`
+}
+
+// BugzillaError is the envelope Bugzilla's REST API answers with instead of
+// the requested data when it rejects a query, e.g. a bad field or a rate
+// limit. Without checking it, a rejected search decodes as no bugs at all.
+type BugzillaError struct {
+	Error   bool   `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+// err returns the envelope as an error, or nil when the request succeeded.
+func (e BugzillaError) err() error {
+	if !e.Error {
+		return nil
+	}
+	return fmt.Errorf("bugzilla error %d: %s", e.Code, e.Message)
 }
 
 type BugListResponse struct {
+	BugzillaError
 	Bugs []Bug `json:"bugs"`
 }
 
 type Result struct {
-	ID              int
-	Link            string
-	NumberFailures  int
-	Summary         string
-	Component       string
-	Age             string
-	Rate            string
-	Trend           string
-	TwoDay          int
-	TwoDayRate      string
-	TwoDayPlatforms []string
-	TwoDayBreakdown []string
-	Platforms       []string
-	BreakdownList   []string
-	Needinfo        string
-	GraphLink       string
-	Assignee        string
+	ID             int    `json:"id"`
+	Link           string `json:"link"`
+	NumberFailures int    `json:"number_failures"`
+	// FailuresPerDay is NumberFailures over the days since the bug's first
+	// failure in the window.
+	FailuresPerDay  float64         `json:"failures_per_day"`
+	Summary         string          `json:"summary"`
+	Component       string          `json:"component"`
+	Age             string          `json:"age"`
+	Rate            string          `json:"rate"`
+	TestRuns        int             `json:"test_runs"`
+	Trend           string          `json:"trend"`
+	TwoDay          int             `json:"two_day"`
+	TwoDayRate      string          `json:"two_day_rate"`
+	TwoDayPlatforms []PlatformCount `json:"two_day_platforms"`
+	TwoDayBreakdown []string        `json:"two_day_breakdown"`
+	Platforms       []PlatformCount `json:"platforms"`
+	// OSVersions are the OS versions behind Platforms, parsed from the raw
+	// Treeherder names that normalization shortens.
+	OSVersions      []PlatformInfo `json:"os_versions,omitempty"`
+	BreakdownList   []string       `json:"breakdown_list"`
+	Needinfo        string         `json:"needinfo"`
+	NeedinfoSetter  string         `json:"needinfo_setter"`
+	NeedinfoCreated string         `json:"needinfo_created"`
+	GraphLink       string         `json:"graph_link"`
+	Assignee        string         `json:"assignee"`
+	Stalled         bool           `json:"stalled"`
+	Reopened        bool           `json:"reopened"`
+	Runbook         string         `json:"runbook"`
+	Note            string         `json:"note"`
+	CommentCount    int            `json:"comment_count"`
+	QAContact       string         `json:"qa_contact"`
+	Verification    string         `json:"verification"`
+	Priority        string         `json:"priority"`
+	Whiteboard      string         `json:"whiteboard"`
+	HasBaseline     bool           `json:"has_baseline"`
+	Baseline        int            `json:"baseline"`
+	OverBaseline    int            `json:"over_baseline"`
+	// Compared is set when --compare found a previous report; New marks
+	// bugs missing from it and Delta is the change in failures otherwise.
+	Compared bool `json:"compared"`
+	New      bool `json:"new"`
+	Delta    int  `json:"delta"`
+	// WindowStart and WindowEnd are the days NumberFailures was counted over.
+	WindowStart string `json:"window_start"`
+	WindowEnd   string `json:"window_end"`
+	// LastFailure is the push time of the most recent failure (UTC).
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	// AboveP90 marks a failure count above the report's 90th percentile.
+	AboveP90 bool `json:"above_p90,omitempty"`
+}
+
+// LastSeen describes how long ago the bug last failed, e.g. "5 hours".
+func (r Result) LastSeen() string {
+	if r.LastFailure.IsZero() {
+		return ""
+	}
+	switch d := time.Since(r.LastFailure); {
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
 }
 
 type PermaBug struct {
-	ID              int
-	Link            string
-	Summary         string
-	Component       string
-	Age             string
-	Assignee        string
-	GraphLink       string
-	Needinfo        string
-	NumberFailures  int
-	TwoDayFailures  int
-	Platforms       []string
-	BreakdownList   []string
-	TwoDayPlatforms []string
-	TwoDayBreakdown []string
+	ID              int             `json:"id"`
+	Link            string          `json:"link"`
+	Summary         string          `json:"summary"`
+	Component       string          `json:"component"`
+	Age             string          `json:"age"`
+	Assignee        string          `json:"assignee"`
+	GraphLink       string          `json:"graph_link"`
+	Needinfo        string          `json:"needinfo"`
+	NeedinfoSetter  string          `json:"needinfo_setter"`
+	NeedinfoCreated string          `json:"needinfo_created"`
+	Stalled         bool            `json:"stalled"`
+	Reopened        bool            `json:"reopened"`
+	Runbook         string          `json:"runbook"`
+	Note            string          `json:"note"`
+	CommentCount    int             `json:"comment_count"`
+	QAContact       string          `json:"qa_contact"`
+	Verification    string          `json:"verification"`
+	Priority        string          `json:"priority"`
+	Whiteboard      string          `json:"whiteboard"`
+	NumberFailures  int             `json:"number_failures"`
+	TwoDayFailures  int             `json:"two_day_failures"`
+	Platforms       []PlatformCount `json:"platforms"`
+	OSVersions      []PlatformInfo  `json:"os_versions,omitempty"`
+	BreakdownList   []string        `json:"breakdown_list"`
+	TwoDayPlatforms []PlatformCount `json:"two_day_platforms"`
+	TwoDayBreakdown []string        `json:"two_day_breakdown"`
 }
 
 type TaskTimeoutReport struct {
-	Link                 string
-	GraphLink            string
-	PerfFailures         int
-	SuiteBreakdown       []string
-	TreeBreakdown        []string
-	Platforms            []string
-	TwoDayPerfFailures   int
-	TwoDaySuiteBreakdown []string
-	TwoDayTreeBreakdown  []string
-	TwoDayPlatforms      []string
+	Link                 string          `json:"link"`
+	GraphLink            string          `json:"graph_link"`
+	PerfFailures         int             `json:"perf_failures"`
+	SuiteBreakdown       []string        `json:"suite_breakdown"`
+	TreeBreakdown        []string        `json:"tree_breakdown"`
+	Platforms            []PlatformCount `json:"platforms"`
+	TwoDayPerfFailures   int             `json:"two_day_perf_failures"`
+	TwoDaySuiteBreakdown []string        `json:"two_day_suite_breakdown"`
+	TwoDayTreeBreakdown  []string        `json:"two_day_tree_breakdown"`
+	TwoDayPlatforms      []PlatformCount `json:"two_day_platforms"`
 }
 
 type ComponentGroup[T any] struct {
-	Name string
-	Bugs []T
+	Name  string
+	Owner string
+	Bugs  []T
 }
 
 type hasComponent interface {
@@ -122,6 +306,13 @@ type hasComponent interface {
 func (r Result) component() string   { return r.Component }
 func (p PermaBug) component() string { return p.Component }
 
+type hasPlatforms interface {
+	platforms() []PlatformCount
+}
+
+func (r Result) platforms() []PlatformCount   { return r.Platforms }
+func (p PermaBug) platforms() []PlatformCount { return p.Platforms }
+
 func bugAge(creationTime string) string {
 	t, err := time.Parse(time.RFC3339, creationTime)
 	if err != nil {
@@ -131,6 +322,85 @@ func bugAge(creationTime string) string {
 	return fmt.Sprintf("%d days", days)
 }
 
+// needinfoOf returns the first open needinfo flag, or a zero Flag.
+func needinfoOf(flags []Flag) Flag {
+	for _, f := range flags {
+		if f.Name == "needinfo" && f.Requestee != "" {
+			return f
+		}
+	}
+	return Flag{}
+}
+
+// verificationOf returns the qe-verify flag state ("+", "?" or "-"), or "" if unset.
+func verificationOf(flags []Flag) string {
+	for _, f := range flags {
+		if f.Name == "qe-verify" {
+			return f.Status
+		}
+	}
+	return ""
+}
+
+// priorityOf returns the bug's priority (P1-P5), or "" for Bugzilla's "--"
+// placeholder meaning it hasn't been prioritized.
+func priorityOf(p string) string {
+	if p == "--" {
+		return ""
+	}
+	return p
+}
+
+type NeedinfoAging struct {
+	UnderThree   int
+	ThreeToSeven int
+	OverSeven    int
+}
+
+func (a NeedinfoAging) Total() int { return a.UnderThree + a.ThreeToSeven + a.OverSeven }
+
+// needinfoAging buckets every pending needinfo in the report by how many days
+// it has been waiting, based on the flag's creation date.
+func needinfoAging(results []Result, permas []PermaBug) NeedinfoAging {
+	var a NeedinfoAging
+	add := func(created string) {
+		t, err := time.Parse(time.RFC3339, created)
+		if err != nil {
+			return
+		}
+		switch days := time.Since(t).Hours() / 24; {
+		case days < 3:
+			a.UnderThree++
+		case days <= 7:
+			a.ThreeToSeven++
+		default:
+			a.OverSeven++
+		}
+	}
+	for _, r := range results {
+		if r.Needinfo != "" {
+			add(r.NeedinfoCreated)
+		}
+	}
+	for _, p := range permas {
+		if p.Needinfo != "" {
+			add(p.NeedinfoCreated)
+		}
+	}
+	return a
+}
+
+// isStalled reports whether the bug carries Bugzilla's "stalled" keyword,
+// which marks bugs blocked on a decision or external dependency.
+func isStalled(keywords []string) bool {
+	for _, k := range keywords {
+		if strings.EqualFold(k, "stalled") {
+			return true
+		}
+	}
+	return false
+}
+
 func computeTrend(current, previous int) string {
 	if previous == 0 {
 		return "🆕"
@@ -145,6 +415,134 @@ func computeTrend(current, previous int) string {
 	return ""
 }
 
+// groupByPlatform groups items by OS family, alphabetically. An item failing
+// on several families appears in each of their groups.
+func groupByPlatform[T hasPlatforms](items []T) []ComponentGroup[T] {
+	m := map[string][]T{}
+	for _, item := range items {
+		seen := map[string]bool{}
+		for _, p := range item.platforms() {
+			family := parsePlatform(p.Name).Family
+			if family == "" {
+				family = p.Name
+			}
+			if !seen[family] {
+				seen[family] = true
+				m[family] = append(m[family], item)
+			}
+		}
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	groups := make([]ComponentGroup[T], 0, len(names))
+	for _, name := range names {
+		groups = append(groups, ComponentGroup[T]{Name: name, Bugs: m[name]})
+	}
+	return groups
+}
+
+func setOwners[T any](groups []ComponentGroup[T]) {
+	for i := range groups {
+		groups[i].Owner = triageOwners[groups[i].Name]
+	}
+}
+
+// rollUpSmallGroups merges groups with fewer than min bugs into a trailing
+// "Other" group so quiet components don't each get their own section.
+func rollUpSmallGroups[T any](groups []ComponentGroup[T], minBugs int) []ComponentGroup[T] {
+	if minBugs <= 1 {
+		return groups
+	}
+	var kept []ComponentGroup[T]
+	other := ComponentGroup[T]{Name: "Other"}
+	for _, g := range groups {
+		if len(g.Bugs) < minBugs {
+			other.Bugs = append(other.Bugs, g.Bugs...)
+		} else {
+			kept = append(kept, g)
+		}
+	}
+	if len(other.Bugs) > 0 {
+		kept = append(kept, other)
+	}
+	return kept
+}
+
+// reportFilters are the flags that narrow down which analyzed bugs are
+// reported.
+type reportFilters struct {
+	hideNeedinfo         bool
+	awaitingVerification bool
+	osVersion            string
+	platforms            []string
+}
+
+// apply filters the intermittents, the below-threshold list and the permas
+// alike, so every section answers to the same flags, and trims their
+// platform lists to --platform. hidden counts the intermittents and permas
+// dropped for an open needinfo.
+func (f reportFilters) apply(results, below []Result, permas []PermaBug) (_, _ []Result, _ []PermaBug, hidden int) {
+	keep := func(id int, needinfo, verification string, versions []PlatformInfo, platforms []PlatformCount) bool {
+		switch {
+		case f.hideNeedinfo && needinfo != "":
+			return skipped(id, "open needinfo")
+		case f.awaitingVerification && verification != "+":
+			return skipped(id, "not awaiting verification")
+		case f.osVersion != "" && !matchesOSVersion(versions, f.osVersion):
+			return skipped(id, "not failing on "+f.osVersion)
+		case len(f.platforms) > 0 && len(matchingPlatforms(platforms, f.platforms)) == 0:
+			return skipped(id, "no matching platform")
+		}
+		return true
+	}
+	filterResults := func(rs []Result) []Result {
+		rs = filterBugs(rs, func(r Result) bool { return keep(r.ID, r.Needinfo, r.Verification, r.OSVersions, r.Platforms) })
+		if len(f.platforms) > 0 {
+			// other platforms' failures are noise to a platform team
+			for i := range rs {
+				rs[i].Platforms = matchingPlatforms(rs[i].Platforms, f.platforms)
+				rs[i].TwoDayPlatforms = matchingPlatforms(rs[i].TwoDayPlatforms, f.platforms)
+			}
+		}
+		return rs
+	}
+
+	if f.hideNeedinfo {
+		for _, r := range results {
+			if r.Needinfo != "" {
+				hidden++
+			}
+		}
+		for _, p := range permas {
+			if p.Needinfo != "" {
+				hidden++
+			}
+		}
+	}
+	results, below = filterResults(results), filterResults(below)
+	permas = filterBugs(permas, func(p PermaBug) bool { return keep(p.ID, p.Needinfo, p.Verification, p.OSVersions, p.Platforms) })
+	if len(f.platforms) > 0 {
+		for i := range permas {
+			permas[i].Platforms = matchingPlatforms(permas[i].Platforms, f.platforms)
+			permas[i].TwoDayPlatforms = matchingPlatforms(permas[i].TwoDayPlatforms, f.platforms)
+		}
+	}
+	return results, below, permas, hidden
+}
+
+func filterBugs[T any](items []T, keep func(T) bool) []T {
+	var out []T
+	for _, item := range items {
+		if keep(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func groupByComponent[T hasComponent](items []T, order []string) []ComponentGroup[T] {
 	m := map[string][]T{}
 	for _, item := range items {
@@ -160,6 +558,29 @@ func groupByComponent[T hasComponent](items []T, order []string) []ComponentGrou
 	return groups
 }
 
+type ProductResponse struct {
+	BugzillaError
+	Products []struct {
+		Components []struct {
+			Name        string `json:"name"`
+			TriageOwner string `json:"triage_owner"`
+		} `json:"components"`
+	} `json:"products"`
+}
+
+type BugHistoryResponse struct {
+	BugzillaError
+	Bugs []struct {
+		History []struct {
+			Changes []struct {
+				FieldName string `json:"field_name"`
+				Removed   string `json:"removed"`
+				Added     string `json:"added"`
+			} `json:"changes"`
+		} `json:"history"`
+	} `json:"bugs"`
+}
+
 type THFailure struct {
 	BugID    *int `json:"bug_id"`
 	BugCount int  `json:"bug_count"`
@@ -169,6 +590,7 @@ type THJobFailure struct {
 	Platform  string `json:"platform"`
 	Tree      string `json:"tree"`
 	TestSuite string `json:"test_suite"`
+	PushTime  string `json:"push_time"`
 }
 
 type THDailyCount struct {
@@ -184,609 +606,3155 @@ func main() {
 	// setup CLI flags for disabling the automatic HTML report opening in browser and allowing
 	// user to specify number of concurrent fetches
 	noOpen := flag.Bool("no-open", false, "Disable opening browser after generating report")
+	flag.BoolVar(&quiet, "quiet", false, "Don't print analysis progress to stderr")
+	openWith := flag.String("open-with", "", "Command to open the report with, e.g. firefox, instead of the OS default")
+	reuseTab := flag.Bool("reuse-tab", false, "Best effort: open the report without raising a new browser window (macOS only)")
 	concurrency := flag.Int("concurrency", 10, "Maximum number of concurrent Treeherder breakdown fetches")
-	flag.IntVar(&threshold, "threshold", 20, "Minimum failure count to include a bug")
+	flag.IntVar(&threshold, "threshold", 20, "Minimum failure count to include a bug (0 = any failure in the window)")
+	flag.Float64Var(&thresholdPercentile, "threshold-percentile", 0, "Set the threshold to this percentile (0-100) of the run's failure counts instead of --threshold")
 	flag.IntVar(&daysBack, "days", 7, "Number of days back to query")
+	timezone := flag.String("timezone", "UTC", "IANA time zone for displayed dates (queries always use UTC)")
+	flag.BoolVar(&crossCheck, "cross-check", false, "Warn when a bug's failure count disagrees with its repository breakdown")
+	flag.BoolVar(&checkReopened, "check-reopened", false, "Flag bugs reopened during the window (one extra Bugzilla request per bug)")
+	showBelow := flag.Bool("show-below-threshold", false, "Also list bugs under the threshold in a collapsed section")
+	countTreesFlag := flag.String("count-trees", "", "Comma-separated trees whose failures count toward the threshold (default all)")
+	repoOrderFlag := flag.String("repo-order", "", "Comma-separated repository priority for breakdowns; * marks where unlisted repos go")
+	maxRuntime := flag.Duration("max-runtime", 0, "Stop fetching after this long and write a partial report, e.g. 5m (0 = no limit)")
+	componentsFile := flag.String("components-file", "", "File of components to triage, one per line; merged with --components")
+	productsFlag := flag.String("products", "Testing", "Comma-separated Bugzilla products to search, e.g. \"Testing, Core\"")
+	componentsFlag := flag.String("components", "", "Comma-separated components of the --products to triage instead of the performance ones")
+	flag.IntVar(&minBugsPerComponent, "min-bugs-per-component", 0, "Roll components with fewer bugs than this into an \"Other\" section")
+	flag.IntVar(&bugPageSize, "page-size", bugPageSize, "Bugs per Bugzilla search request; larger searches are paged")
+	failOver := flag.Int("fail-over", 0, "Exit with status 2 after writing the report when any intermittent has at least this many failures (0 = never)")
+	top := flag.Int("top", 0, "Only report the first N intermittents in sort order (0 = all)")
+	flag.StringVar(&sortKey, "sort", "failures", "Order bugs by failures, per-day (failures per active day), id, assignee or summary")
+	flag.StringVar(&groupBy, "group-by", "component", "Group report sections by component or platform")
+	hideNeedinfo := flag.Bool("hide-needinfo", false, "Hide bugs that already have an open needinfo")
+	awaitingVerification := flag.Bool("awaiting-verification", false, "Only report bugs whose qe-verify flag is set to +")
+	maxComments := flag.Int("max-comments", 0, "Hide bugs with more than this many comments (0 = no limit)")
+	platformFlag := flag.String("platform", "", "Comma-separated platform substrings or OS families, e.g. android or windows; only failures there are reported")
+	osVersion := flag.String("os-version", "", "Only report bugs failing on this OS version, e.g. windows11, linux2404 or android14")
+	bugIDList := flag.String("bug-ids", "", "Comma-separated bug IDs to report on instead of running the searches")
+	singleBug := flag.Int("bug", 0, "Print the analyzed detail for a single bug instead of writing a report")
+	runbookFile := flag.String("runbooks", "", "File mapping summary glob patterns to runbook URLs")
+	templateFile := flag.String("template", "", "HTML template file to render instead of the built-in one")
+	flag.StringVar(&logoURL, "logo-url", "", "Image URL shown at the top of the report")
+	flag.StringVar(&accentColor, "accent-color", "", "CSS color for report headings, e.g. #0060df")
+	notesFile := flag.String("notes", "", "File of \"<bug ID> <note>\" triage notes shown next to each bug")
+	baselineFile := flag.String("baselines", "", "File of \"<bug ID or component> <failures>\" expected baselines")
+	autoComment := flag.Bool("auto-comment", false, "Print a triage comment for each unassigned bug without a needinfo; add --confirm-auto-comment to post them")
+	confirmAutoComment := flag.Bool("confirm-auto-comment", false, "Actually post the --auto-comment comments to Bugzilla (needs --api-key)")
+	dryRun := flag.Bool("dry-run", false, "Print the Bugzilla search URLs instead of running them")
+	showExamples := flag.Bool("examples", false, "Print example invocations and exit")
+	flag.Var((*secondsFlag)(&httpClient.Timeout), "timeout", "Timeout for each HTTP request in seconds, or as a duration such as 2m")
+	// the environment fallback is applied after parsing so -help never
+	// prints the key as the flag's default
+	bugzillaURL := flag.String("bugzilla-url", "", "Bugzilla site to query, e.g. a staging instance (default $BUGZILLA_URL or https://bugzilla.mozilla.org)")
+	flag.StringVar(&bugzillaAPIKey, "api-key", "", "Bugzilla API key (default $BUGZILLA_API_KEY)")
+	proxy := flag.String("proxy", "", "HTTP proxy URL (overrides HTTP_PROXY/HTTPS_PROXY)")
+	flag.IntVar(&excludeLinkedTo, "exclude-resolved-duplicate-of", 0, "Skip bugs that are duplicates of, block or depend on this meta bug ID")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory for cached metadata and Treeherder responses (default the user cache directory)")
+	flag.BoolVar(&treeherderCache, "cache", false, "Cache Treeherder per-bug data on disk so repeated runs during a triage session are faster")
+	flag.BoolVar(&noCache, "no-cache", false, "Always fetch Treeherder per-bug data, even with --cache")
+	flag.DurationVar(&metadataTTL, "metadata-ttl", 24*time.Hour, "How long cached component metadata such as triage owners stays fresh")
+	flag.BoolVar(&refreshMetadata, "refresh-metadata", false, "Ignore cached component metadata and fetch it again")
+	strictParse := flag.Bool("strict-parse", false, "Fail when a reported bug has failures but an empty platform and repository breakdown")
+	fromJSON := flag.String("from-json", "", "Render a saved --format json report as HTML without fetching anything, e.g. to iterate on --template")
+	compareFile := flag.String("compare", "", "Previous --format json report to compare failure counts against")
+	outputFlag := flag.String("output", outputHTML, "Report path, used as given for the first --format; the others swap in their own extension (.html for html, .md for gfm, .markdown for md, .json for json)")
+	format := flag.String("format", "html", "Comma-separated report formats: html, gfm (GitHub Markdown table of the intermittents), md (nested Markdown lists) and/or json")
+	flag.BoolVar(&prettyJSON, "pretty", false, "Indent --format json output instead of writing it compactly")
+	flag.BoolVar(&gzipJSON, "gzip", false, "Gzip --format json output, written as report.json.gz (implied by an --output ending in .gz)")
+	flag.StringVar(&lang, "lang", "en", "Locale for the report's labels: en or de")
+	slackWebhook := flag.String("slack-webhook", "", "Slack incoming webhook URL to post the top intermittents to")
+	slackTop := flag.Int("slack-top", 10, "Number of intermittents to list in the Slack message")
+	githubRepo := flag.String("github-repo", "", "GitHub repository (owner/name) whose --github-issue gets the intermittents table as a comment")
+	githubIssue := flag.Int("github-issue", 0, "GitHub issue number to comment on, with --github-repo")
+	githubToken := flag.String("github-token", "", "GitHub token allowed to comment on --github-repo (default $GITHUB_TOKEN)")
+	githubForce := flag.Bool("github-force", false, "Comment on the GitHub issue even when there are no intermittents to report")
+	smtpHost := flag.String("smtp-host", "", "SMTP server to email the HTML report through (password from $SMTP_PASSWORD)")
+	smtpPort := flag.Int("smtp-port", 587, "SMTP server port")
+	smtpUser := flag.String("smtp-user", "", "SMTP username (default --smtp-from)")
+	smtpFrom := flag.String("smtp-from", "", "Sender address of the report email")
+	smtpTo := flag.String("smtp-to", "", "Comma-separated recipients of the report email")
+	uploadURL := flag.String("upload-url", "", "Presigned https URL to PUT the report to after writing it")
+	uploadFormat := flag.String("upload-format", "", "Which --format's report --upload-url uploads (default the first), e.g. json while html stays local")
+	serveAddr := flag.String("serve", "", "Serve the HTML report at this address, e.g. :8080, instead of writing files")
+	serveInterval := flag.Duration("serve-interval", time.Hour, "How often --serve regenerates the report")
+	serveMaxAge := flag.Duration("serve-max-age", 0, "How old the served report may get before /healthz fails (default twice --serve-interval)")
+	var since string
+	flag.StringVar(&since, "since", "", "Start the window at a date (YYYY-MM-DD, UTC), e.g. the last release or all-green date, instead of --days")
+	flag.StringVar(&since, "since-green-date", "", "Deprecated alias for --since")
+	verbose := flag.Bool("verbose", false, "Log debug detail, such as why each bug was skipped")
 	flag.Parse()
-	maxConcurrent = *concurrency
-
-	fmt.Println("Generating PerfTest triage report...")
-
-	startDay := time.Now().AddDate(0, 0, -daysBack).Format("2006-01-02")
-	endDay := time.Now().Format("2006-01-02")
-	prevStartDay := time.Now().AddDate(0, 0, -daysBack*2).Format("2006-01-02")
-	twoDayStart := time.Now().AddDate(0, 0, -2).Format("2006-01-02")
-	var interBugs []Bug
-	var rawPermas []PermaBug
-	var currentCounts, prevCounts, twoDayCounts map[int]int
-	var wg sync.WaitGroup
-	wg.Add(5)
-	go func() { defer wg.Done(); interBugs = fetchIntermittentBugs() }()
-	go func() { defer wg.Done(); rawPermas = fetchPermaBugs(startDay, endDay) }()
-	go func() { defer wg.Done(); currentCounts = fetchTreeherderCounts(startDay, endDay) }()
-	go func() { defer wg.Done(); prevCounts = fetchTreeherderCounts(prevStartDay, startDay) }()
-	go func() { defer wg.Done(); twoDayCounts = fetchTreeherderCounts(twoDayStart, endDay) }()
-	wg.Wait()
-
-	var results []Result
-	var permas []PermaBug
-	var taskTimeout *TaskTimeoutReport
-	var wg2 sync.WaitGroup
-	wg2.Add(3)
-	go func() {
-		defer wg2.Done()
-		results = analyzeAll(interBugs, startDay, endDay, currentCounts, prevCounts, twoDayStart, twoDayCounts)
-	}()
-	go func() {
-		defer wg2.Done()
-		permas = enrichPermas(rawPermas, startDay, endDay, twoDayStart, currentCounts, twoDayCounts)
-	}()
-	go func() {
-		defer wg2.Done()
-		taskTimeout = analyzeTaskTimeout(startDay, endDay, twoDayStart)
-	}()
-	wg2.Wait()
-
-	if len(results) == 0 && len(permas) == 0 {
-		fmt.Println("No matching bugs found.")
-		return
+	outputSet := false
+	flag.Visit(func(f *flag.Flag) { outputSet = outputSet || f.Name == "output" })
+	if outputSet && strings.HasSuffix(*outputFlag, ".gz") {
+		gzipJSON = true
 	}
-
-	writeHTMLReport(results, permas, taskTimeout)
-	fmt.Println("✅ Report written to", outputHTML)
-	if !*noOpen {
-		openInBrowser(outputHTML)
+	setupLogging(*verbose)
+	if *showExamples {
+		printExamples(os.Stdout)
+		os.Exit(0)
 	}
-}
-
-var httpClient = &http.Client{Timeout: 60 * time.Second}
-var retrySleep = func(d time.Duration) { time.Sleep(d) }
-
-func get(u string) (*http.Response, error) {
-	var lastErr error
-	for attempt := range 3 {
-		if attempt > 0 {
-			retrySleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+	setConcurrency(*concurrency)
+	if bugzillaAPIKey == "" {
+		bugzillaAPIKey = os.Getenv("BUGZILLA_API_KEY")
+	}
+	if *bugzillaURL == "" {
+		*bugzillaURL = os.Getenv("BUGZILLA_URL")
+	}
+	if *githubRepo != "" {
+		*githubToken = cmp.Or(*githubToken, os.Getenv("GITHUB_TOKEN"))
+		if owner, name, ok := strings.Cut(*githubRepo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			fatalf("invalid --github-repo %q: want owner/name", *githubRepo)
 		}
-		req, err := http.NewRequest("GET", u, nil)
-		if err != nil {
-			return nil, err
+		if *githubIssue <= 0 {
+			fatalf("--github-repo needs a --github-issue number")
 		}
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("User-Agent", "mozilla-perftest-report/1.0")
-
-		resp, err := httpClient.Do(req)
+		if *githubToken == "" {
+			fatalf("--github-repo needs --github-token or $GITHUB_TOKEN")
+		}
+	}
+	if *bugzillaURL != "" {
+		if err := setBugzillaSite(*bugzillaURL); err != nil {
+			fatalf("invalid --bugzilla-url: %v", err)
+		}
+	}
+	if cacheDir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cacheDir = filepath.Join(dir, "perftest-triage-report")
+		}
+	}
+	displayLoc = loadDisplayLocation(*timezone)
+	if err := setProxy(*proxy); err != nil {
+		fatalf("invalid --proxy: %v", err)
+	}
+	repoOrder = splitList(*repoOrderFlag)
+	if products = splitList(*productsFlag); len(products) == 0 {
+		fatalf("invalid --products: want at least one product")
+	}
+	if *componentsFlag != "" || *componentsFile != "" {
+		var fromFile []string
+		if *componentsFile != "" {
+			var err error
+			if fromFile, err = parseFile(*componentsFile, parseComponents); err != nil {
+				fatalf("load components: %v", err)
+			}
+		}
+		components = nil
+		for _, c := range append(splitList(*componentsFlag), fromFile...) {
+			if !slices.Contains(components, c) {
+				components = append(components, c)
+			}
+		}
+		if len(components) == 0 {
+			fatalf("invalid --components/--components-file: want at least one component")
+		}
+	}
+	countTrees = splitList(*countTreesFlag)
+	filters := reportFilters{
+		hideNeedinfo:         *hideNeedinfo,
+		awaitingVerification: *awaitingVerification,
+		osVersion:            *osVersion,
+		platforms:            splitList(*platformFlag),
+	}
+	if groupBy != "component" && groupBy != "platform" {
+		fatalf("invalid --group-by %q: want component or platform", groupBy)
+	}
+	if !slices.Contains([]string{"failures", "per-day", "id", "assignee", "summary"}, sortKey) {
+		fatalf("invalid --sort %q: want failures, per-day, id, assignee or summary", sortKey)
+	}
+	if accentColor != "" && !cssColorRe.MatchString(accentColor) {
+		fatalf("invalid --accent-color %q: want a hex color or color name", accentColor)
+	}
+	if *runbookFile != "" {
+		var err error
+		if runbooks, err = parseFile(*runbookFile, parseRunbooks); err != nil {
+			fatalf("load runbooks: %v", err)
+		}
+	}
+	if *notesFile != "" {
+		var err error
+		if triageNotes, err = parseFile(*notesFile, parseNotes); err != nil {
+			fatalf("load notes: %v", err)
+		}
+	}
+	if *templateFile != "" {
+		data, err := os.ReadFile(*templateFile)
 		if err != nil {
-			lastErr = err
-			log.Printf("request failed (attempt %d/3): %v", attempt+1, err)
-			continue
+			fatalf("load template: %v", err)
 		}
-		if resp.StatusCode >= 500 {
-			_ = resp.Body.Close()
-			lastErr = fmt.Errorf("status %s", resp.Status)
-			log.Printf("server error (attempt %d/3): %s", attempt+1, resp.Status)
-			continue
+		// parse up front so a broken template fails before any fetching
+		if _, err := parseTemplate(string(data)); err != nil {
+			fatalf("invalid --template: %v", err)
 		}
-		return resp, nil
+		htmlTemplate = string(data)
 	}
-	return nil, lastErr
-}
-
-// ===================== Fetchers =====================
-
-func fetchIntermittentBugs() []Bug {
-	params := url.Values{}
-	params.Set("product", "Testing")
-	params.Set("keywords", "intermittent-failure")
-	params.Set("keywords_type", "allwords")
-	params.Set("resolution", "---")
-	params.Set("include_fields", "id,summary,component,creation_time,flags,assigned_to")
-
-	for _, c := range components {
-		params.Add("component", c)
+	if *baselineFile != "" {
+		var err error
+		if baselines, err = parseFile(*baselineFile, parseBaselines); err != nil {
+			fatalf("load baselines: %v", err)
+		}
 	}
 
-	resp, err := get(bugzillaBase + "?" + params.Encode())
+	bugIDs, err := parseBugIDs(*bugIDList)
 	if err != nil {
-		log.Fatalf("fetch intermittents failed: %v", err)
+		fatalf("invalid --bug-ids: %v", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
+	if *maxRuntime > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(context.Background(), *maxRuntime)
+		defer cancel()
+	}
+	if httpClient.Timeout <= 0 {
+		fatalf("invalid --timeout %s: want a positive duration", httpClient.Timeout)
+	}
+	if bugPageSize <= 0 {
+		fatalf("invalid --page-size %d: want a positive number", bugPageSize)
+	}
+	if daysBack <= 0 {
+		fatalf("invalid --days %d: want a positive number of days", daysBack)
+	}
+	mailTo := splitList(*smtpTo)
+	if *smtpHost != "" && (*smtpFrom == "" || len(mailTo) == 0) {
+		fatalf("--smtp-host needs --smtp-from and --smtp-to")
+	}
+	if *confirmAutoComment && !*autoComment {
+		fatalf("--confirm-auto-comment needs --auto-comment")
+	}
+	if *confirmAutoComment && bugzillaAPIKey == "" {
+		fatalf("--confirm-auto-comment needs --api-key or $BUGZILLA_API_KEY to post comments")
+	}
+	if *serveInterval <= 0 {
+		fatalf("invalid --serve-interval %s: want a positive duration", *serveInterval)
+	}
+	if *serveMaxAge < 0 {
+		fatalf("invalid --serve-max-age %s: want a positive duration", *serveMaxAge)
+	}
+	if *serveMaxAge == 0 {
+		*serveMaxAge = 2 * *serveInterval
+	}
+	formats := splitList(*format)
+	if len(formats) == 0 {
+		fatalf("invalid --format: want html, gfm, md or json")
+	}
+	for _, f := range formats {
+		if _, ok := formatExts[f]; !ok {
+			fatalf("invalid --format %q: want html, gfm, md or json", f)
 		}
-	}()
-
-	var out BugListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		log.Fatalf("bad intermittent bug JSON: %v", err)
 	}
-	filtered := make([]Bug, 0, len(out.Bugs))
-	for _, b := range out.Bugs {
-		if !strings.Contains(strings.ToLower(b.Summary), "perma") {
-			filtered = append(filtered, b)
+	if *uploadFormat == "" {
+		*uploadFormat = formats[0]
+	} else if !slices.Contains(formats, *uploadFormat) {
+		fatalf("invalid --upload-format %q: not one of --format %s", *uploadFormat, *format)
+	}
+	if _, ok := messages[lang]; !ok && lang != "en" {
+		fatalf("invalid --lang %q: want en or de", lang)
+	}
+	if thresholdPercentile < 0 || thresholdPercentile > 100 {
+		fatalf("invalid --threshold-percentile %v: want 0-100", thresholdPercentile)
+	}
+	if len(bugIDs) > 0 || *singleBug > 0 {
+		// an explicit list is reported in full, whatever its failure counts
+		threshold = -1
+		thresholdPercentile = 0
+	}
+
+	if *fromJSON != "" {
+		output := outputPath(*outputFlag, "html", outputSet)
+		if err := renderFromJSON(*fromJSON, output); err != nil {
+			fatalf("--from-json: %v", err)
 		}
+		fmt.Println("✅ Report written to", output)
+		if !*noOpen {
+			openInBrowser(output, *reuseTab, *openWith)
+		}
+		return
 	}
-	return filtered
-}
 
-func fetchPermaBugs(start, end string) []PermaBug {
-	params := url.Values{}
-	params.Set("product", "Testing")
-	params.Set("resolution", "---")
-	params.Set("short_desc", "Perma")
-	params.Set("short_desc_type", "allwordssubstr")
-	params.Set("last_change_time", start)
-	params.Set("include_fields", "id,summary,component,creation_time,assigned_to,flags")
-	params.Set("keywords", "intermittent-failure")
+	fmt.Println("Generating PerfTest triage report...")
 
-	for _, c := range components {
-		params.Add("component", c)
+	// window boundaries are computed in UTC so the queried days don't shift
+	// with the machine's local zone; --timezone only affects display. It is
+	// recomputed for each --serve regeneration so the dashboard keeps up
+	// with the calendar.
+	window := func() (startDay, endDay, prevStartDay, twoDayStart string, err error) {
+		now := time.Now().UTC()
+		if since != "" {
+			if daysBack, err = daysSince(since, now); err != nil {
+				return "", "", "", "", fmt.Errorf("invalid --since: %w", err)
+			}
+		}
+		return now.AddDate(0, 0, -daysBack).Format("2006-01-02"),
+			now.Format("2006-01-02"),
+			now.AddDate(0, 0, -daysBack*2).Format("2006-01-02"),
+			now.AddDate(0, 0, -2).Format("2006-01-02"), nil
 	}
-
-	resp, err := get(bugzillaBase + "?" + params.Encode())
+	startDay, endDay, prevStartDay, twoDayStart, err := window()
 	if err != nil {
-		log.Fatalf("fetch failed: %v", err)
+		fatalf("%v", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
-		}
-	}()
 
-	var out BugListResponse
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		log.Fatalf("bad bug JSON: %v", err)
+	if *dryRun {
+		fmt.Println("Intermittent search:", searchURL(intermittentSearch(), 0))
+		fmt.Println("Perma search:", searchURL(permaSearch(startDay), 0))
+		return
 	}
 
-	var permas []PermaBug
-	for _, b := range out.Bugs {
-		ni := ""
-		for _, flag := range b.Flags {
-			if flag.Name == "needinfo" && flag.Requestee != "" {
-				ni = flag.Requestee
-				break
-			}
+	if *singleBug > 0 {
+		quiet = true // a counter for one bug is just noise
+		bugs, err := fetchBugsByID([]int{*singleBug})
+		if err != nil {
+			fatalf("%v", err)
 		}
-
-		assignee := b.AssignedTo
-		if assignee == "nobody@mozilla.org" {
-			assignee = ""
+		currentCounts, prevCounts, twoDayCounts, err := fetchWindowCounts(startDay, endDay, prevStartDay, twoDayStart)
+		if err != nil {
+			fatalf("%v", err)
 		}
-		graphURL := fmt.Sprintf(
-			"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
-			start, end, b.ID,
-		)
-		permas = append(permas, PermaBug{
-			ID:        b.ID,
-			Link:      fmt.Sprintf("https://bugzilla.mozilla.org/show_bug.cgi?id=%d", b.ID),
-			Summary:   b.Summary,
-			Component: b.Component,
-			Age:       bugAge(b.CreationTime),
-			Assignee:  assignee,
-			GraphLink: graphURL,
-			Needinfo:  ni,
-		})
+		results := analyzeAll(bugs, startDay, endDay, currentCounts, prevCounts, twoDayStart, twoDayCounts)
+		if len(results) == 0 {
+			fatalf("bug %d not found", *singleBug)
+		}
+		printBugDetail(os.Stdout, results[0])
+		return
 	}
-	return permas
-}
-
-func enrichPermas(permas []PermaBug, start, end, twoDayStart string, counts, twoDayCounts map[int]int) []PermaBug {
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	sema := make(chan struct{}, maxConcurrent)
-
-	for i, p := range permas {
-		wg.Add(1)
-		sema <- struct{}{}
 
-		go func(idx int, bug PermaBug) {
+	// collect runs the searches and per-bug analysis and applies the
+	// report filters. It fails when no search succeeded or the Treeherder
+	// counts are unavailable, never exiting, so --serve outlives a blip.
+	collect := func(startDay, endDay, prevStartDay, twoDayStart string) (results []Result, permas []PermaBug, taskTimeout *TaskTimeoutReport, below, resolved []Result, err error) {
+		var interBugs []Bug
+		var rawPermas []PermaBug
+		var interErr, permaErr, countsErr error
+		var currentCounts, prevCounts, twoDayCounts map[int]int
+		var wg sync.WaitGroup
+		wg.Add(4)
+		go func() {
 			defer wg.Done()
-			defer func() { <-sema }()
+			if len(bugIDs) > 0 {
+				interBugs, interErr = fetchBugsByID(bugIDs)
+			} else {
+				interBugs, interErr = fetchIntermittentBugs()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if len(bugIDs) == 0 {
+				rawPermas, permaErr = fetchPermaBugs(startDay, endDay)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			currentCounts, prevCounts, twoDayCounts, countsErr = fetchWindowCounts(startDay, endDay, prevStartDay, twoDayStart)
+		}()
+		go func() { defer wg.Done(); triageOwners = cachedTriageOwners() }()
+		wg.Wait()
+
+		// every section is ranked by the counts, so there is nothing to
+		// report without them, unless --max-runtime cut the fetch short and
+		// a partial report was asked for
+		if countsErr != nil {
+			if runCtx.Err() == nil {
+				return nil, nil, nil, nil, nil, countsErr
+			}
+			slog.Warn("Treeherder counts incomplete", "err", countsErr)
+		}
+		// a blip on one search still leaves the other's sections worth
+		// reporting; only give up when there is nothing left
+		if interErr != nil && (permaErr != nil || len(bugIDs) > 0) && runCtx.Err() == nil {
+			return nil, nil, nil, nil, nil, errors.Join(interErr, permaErr)
+		}
+		for _, e := range []struct {
+			err  error
+			what string
+		}{{interErr, "intermittents"}, {permaErr, "perma bugs"}} {
+			if e.err != nil {
+				slog.Error("search failed, writing a partial report", "err", e.err)
+				failedSearches = append(failedSearches, e.what)
+			}
+		}
 
-			breakdowns, platforms := fetchTreeherderBreakdown(bug.ID, start, end)
-			twoDayBreakdowns, twoDayPlatforms := fetchTreeherderBreakdown(bug.ID, twoDayStart, end)
-			mu.Lock()
-			permas[idx].NumberFailures = counts[bug.ID]
-			permas[idx].TwoDayFailures = twoDayCounts[bug.ID]
-			permas[idx].BreakdownList = breakdowns
-			permas[idx].Platforms = platforms
-			permas[idx].TwoDayBreakdown = twoDayBreakdowns
-			permas[idx].TwoDayPlatforms = twoDayPlatforms
-			mu.Unlock()
-		}(i, p)
+		if thresholdPercentile > 0 {
+			threshold = percentileThreshold(interBugs, currentCounts, thresholdPercentile)
+			fmt.Printf("Threshold: %d failures (%gth percentile)\n", threshold, thresholdPercentile)
+		}
+
+		if *maxComments > 0 {
+			withinLimit := func(id, n int) bool { return n <= *maxComments || skipped(id, "too many comments") }
+			before := len(interBugs) + len(rawPermas)
+			interBugs = filterBugs(interBugs, func(b Bug) bool { return withinLimit(b.ID, b.CommentCount) })
+			rawPermas = filterBugs(rawPermas, func(p PermaBug) bool { return withinLimit(p.ID, p.CommentCount) })
+			if hidden := before - len(interBugs) - len(rawPermas); hidden > 0 {
+				fmt.Printf("Hid %d bugs with more than %d comments\n", hidden, *maxComments)
+			}
+		}
+
+		var wg2 sync.WaitGroup
+		wg2.Add(4)
+		go func() {
+			defer wg2.Done()
+			results = analyzeAll(interBugs, startDay, endDay, currentCounts, prevCounts, twoDayStart, twoDayCounts)
+		}()
+		go func() {
+			defer wg2.Done()
+			if *showBelow {
+				below = analyzeBelowThreshold(interBugs, startDay, endDay, currentCounts, prevCounts, twoDayStart, twoDayCounts)
+			}
+		}()
+		go func() {
+			defer wg2.Done()
+			permas = enrichPermas(rawPermas, startDay, endDay, twoDayStart, currentCounts, twoDayCounts)
+		}()
+		go func() {
+			defer wg2.Done()
+			if len(bugIDs) == 0 {
+				taskTimeout = analyzeTaskTimeout(startDay, endDay, twoDayStart)
+			}
+		}()
+		wg2.Wait()
+		if !quiet && progress.done.Load() > 0 {
+			fmt.Fprintln(os.Stderr)
+		}
+		if runCtx.Err() != nil {
+			timeLimited = true
+			slog.Warn("--max-runtime reached, writing a partial report", "max_runtime", *maxRuntime)
+		}
+
+		if ids := missingBreakdowns(results); len(ids) > 0 {
+			if *strictParse {
+				return nil, nil, nil, nil, nil, fmt.Errorf("bugs %v have failures but no platform or repository breakdown", ids)
+			}
+			slog.Warn("bugs have failures but no platform or repository breakdown", "bugs", ids)
+		}
+
+		results, below, permas, hiddenNeedinfo = filters.apply(results, below, permas)
+
+		if failed := analysisFailures(); len(failed) > 0 {
+			slog.Warn("bugs could not be fully analyzed, see the report's \"Could not analyze\" section", "count", len(failed))
+		}
+
+		if *compareFile != "" {
+			if prior, err := parseFile(*compareFile, parseReport); err != nil {
+				slog.Warn("--compare failed", "err", err)
+			} else {
+				resolved = compareResults(results, prior.Results)
+			}
+		}
+
+		// the distribution is taken before --top so it describes the whole week
+		failureStats = annotateOutliers(results)
+
+		// cut after comparing, so bugs outside the top N aren't reported as gone
+		if *top > 0 && len(results) > *top {
+			truncatedFrom = len(results)
+			results = results[:*top]
+		}
+		return results, permas, taskTimeout, below, resolved, nil
 	}
-	wg.Wait()
 
-	filtered := permas[:0]
-	for _, p := range permas {
-		if len(p.BreakdownList) > 0 || len(p.Platforms) > 0 {
-			filtered = append(filtered, p)
+	if *serveAddr != "" {
+		// the counts are fetched fresh on every regeneration, so the per-bug
+		// breakdowns must be too or the page mixes now with this morning
+		noCache = true
+		fatalf("%v", serveReport(*serveAddr, *serveInterval, *serveMaxAge, func() ([]byte, error) {
+			resetRun()
+			if *maxRuntime > 0 {
+				var cancel context.CancelFunc
+				runCtx, cancel = context.WithTimeout(context.Background(), *maxRuntime)
+				defer cancel()
+			}
+			startDay, endDay, prevStartDay, twoDayStart, err := window()
+			if err != nil {
+				return nil, err
+			}
+			results, permas, taskTimeout, below, resolved, err := collect(startDay, endDay, prevStartDay, twoDayStart)
+			if err != nil {
+				return nil, err
+			}
+			var b bytes.Buffer
+			err = renderHTML(&b, htmlTemplate, htmlReportData(results, permas, taskTimeout, below, resolved))
+			return b.Bytes(), err
+		}))
+	}
+
+	results, permas, taskTimeout, below, resolved, err := collect(startDay, endDay, prevStartDay, twoDayStart)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	// a time-limited run is written even when empty, so its note says why
+	if len(results) == 0 && len(permas) == 0 && !timeLimited {
+		fmt.Println("No matching bugs found.")
+		if *githubRepo != "" {
+			notifyGitHub(*githubRepo, *githubIssue, *githubToken, results, *githubForce)
 		}
+		return
+	}
+
+	// each sink fails on its own so one bad output doesn't cost the others
+	var written []string
+	htmlOutput, uploadOutput := "", ""
+	for i, f := range formats {
+		output := outputPath(*outputFlag, f, outputSet && i == 0)
+		var err error
+		switch f {
+		case "gfm":
+			err = writeGFMReport(output, results)
+		case "md":
+			err = writeMarkdownReport(output, results, permas)
+		case "json":
+			err = writeJSONReport(output, results, permas, taskTimeout)
+		default:
+			err = writeHTMLReport(output, results, permas, taskTimeout, below, resolved)
+			if output != "-" {
+				htmlOutput = output
+			}
+		}
+		if err != nil {
+			slog.Warn("writing the report failed", "format", f, "err", err)
+			continue
+		}
+		if output != "-" {
+			fmt.Println("✅ Report written to", output)
+		}
+		written = append(written, output)
+		if f == *uploadFormat {
+			uploadOutput = output
+		}
+	}
+	if len(written) == 0 {
+		fatalf("no report could be written")
+	}
+	if *uploadURL != "" {
+		if uploadOutput == "" {
+			slog.Warn("not uploading: the report was not written", "format", *uploadFormat)
+		} else if err := uploadReport(uploadOutput, *uploadURL); err != nil {
+			slog.Warn("upload failed, the local report is still available", "err", err)
+		} else {
+			fmt.Println("✅ Report uploaded")
+		}
+	}
+	if *slackWebhook != "" {
+		if err := postSlack(*slackWebhook, results, *slackTop); err != nil {
+			slog.Warn("Slack notification failed", "err", err)
+		} else {
+			fmt.Println("✅ Slack notified")
+		}
+	}
+	if *githubRepo != "" {
+		notifyGitHub(*githubRepo, *githubIssue, *githubToken, results, *githubForce)
+	}
+	if *autoComment {
+		autoCommentBugs(results, *confirmAutoComment)
+	}
+	if *smtpHost != "" {
+		if !slices.Contains(written, htmlOutput) {
+			slog.Warn("not emailing the report: no HTML report was written")
+		} else if err := emailReport(*smtpHost, *smtpPort, cmp.Or(*smtpUser, *smtpFrom), *smtpFrom, mailTo, htmlOutput); err != nil {
+			slog.Warn("emailing the report failed, the local report is still available", "err", err)
+		} else {
+			fmt.Println("✅ Report emailed")
+		}
+	}
+	if !*noOpen && slices.Contains(written, htmlOutput) {
+		openInBrowser(htmlOutput, *reuseTab, *openWith)
+	}
+	if ids := failingOver(results, *failOver); len(ids) > 0 {
+		slog.Error("intermittents at or over --fail-over", "fail_over", *failOver, "bugs", ids)
+		fmt.Printf("⏱ Report generated in %s\n", time.Since(start))
+		os.Exit(2)
 	}
-	return filtered
 }
 
-// ===================== Treeherder =====================
+// failingOver returns the IDs of results with at least limit failures, for
+// gating CI on --fail-over. A limit of 0 or less never fails.
+func failingOver(results []Result, limit int) []int {
+	if limit <= 0 {
+		return nil
+	}
+	var ids []int
+	for _, r := range results {
+		if r.NumberFailures >= limit {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// setupLogging sends leveled logs to stderr: info and above by default,
+// debug too with --verbose. Timestamps are dropped as noise for a CLI run.
+func setupLogging(verbose bool) {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+}
+
+// fatalf logs at error level and exits, the slog counterpart of log.Fatalf.
+func fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// skipped logs why a bug was dropped at debug level and returns false, so a
+// filter predicate can read "keep || skipped(id, reason)".
+func skipped(id int, reason string) bool {
+	slog.Debug("skipping bug", "bug", id, "reason", reason)
+	return false
+}
+
+// splitList splits a comma-separated flag value, trimming whitespace and
+// dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// setBugzillaSite points every Bugzilla request and bug link at site, the
+// root URL of a Bugzilla instance.
+func setBugzillaSite(site string) error {
+	u, err := url.Parse(site)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", site)
+	}
+	bugzillaBase = strings.TrimSuffix(site, "/") + "/rest/bug"
+	return nil
+}
+
+// showBugURL is the human-facing page of a bug on the configured Bugzilla.
+func showBugURL(id int) string {
+	return fmt.Sprintf("%s/show_bug.cgi?id=%d", strings.TrimSuffix(bugzillaBase, "/rest/bug"), id)
+}
+
+// parseComponents reads one component name per line, skipping blanks and #
+// comments. Names may contain spaces, e.g. "Performance Engineering".
+func parseComponents(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") && !slices.Contains(out, line) {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+func parseBugIDs(s string) ([]int, error) {
+	var ids []int
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		id, err := strconv.Atoi(f)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("bad bug ID %q", f)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// setConcurrency sets how many bugs are analyzed at once. It is never below
+// 1: the worker semaphores are sized by it, and an unbuffered one would
+// block the first send forever.
+func setConcurrency(n int) {
+	if maxConcurrent = n; maxConcurrent < 1 {
+		slog.Warn("--concurrency is below 1, using 1", "concurrency", n)
+		maxConcurrent = 1
+	}
+}
+
+// secondsFlag is a duration flag that also takes a bare number of seconds,
+// so --timeout 30 and --timeout 30s mean the same.
+type secondsFlag time.Duration
+
+func (f *secondsFlag) String() string { return time.Duration(*f).String() }
+
+func (f *secondsFlag) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil {
+		*f = secondsFlag(time.Duration(n) * time.Second)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("want a number of seconds or a duration such as 2m")
+	}
+	*f = secondsFlag(d)
+	return nil
+}
+
+// daysSince converts a YYYY-MM-DD date into a window size in whole days
+// ending at now, so the rest of the report can keep working in terms of
+// daysBack. A date of today still yields a one-day window.
+func daysSince(date string, now time.Time) (int, error) {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, err
+	}
+	if d.After(now) {
+		return 0, fmt.Errorf("%s is in the future", date)
+	}
+	days := int(now.Sub(d).Hours() / 24)
+	if days < 1 {
+		days = 1
+	}
+	return days, nil
+}
+
+func loadDisplayLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("invalid timezone, falling back to UTC", "timezone", name, "err", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// httpClient uses the default transport, which already honours
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY; --proxy replaces it via setProxy.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+var retrySleep = func(d time.Duration) { time.Sleep(d) }
+
+func setProxy(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("bad proxy URL %q", raw)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = http.ProxyURL(u)
+	httpClient.Transport = t
+	slog.Info("using proxy", "proxy", u.Redacted())
+	return nil
+}
+
+func get(u string) (*http.Response, error) {
+	var lastErr error
+	for attempt := range 3 {
+		if err := runCtx.Err(); err != nil {
+			return nil, err
+		}
+		if attempt > 0 {
+			retrySleep(time.Duration(1<<uint(attempt-1)) * time.Second)
+		}
+		req, err := http.NewRequestWithContext(runCtx, "GET", u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("User-Agent", "mozilla-perftest-report/1.0")
+		if bugzillaAPIKey != "" && strings.HasPrefix(u, strings.TrimSuffix(bugzillaBase, "/bug")) {
+			// a header rather than ?api_key= keeps the key out of logged URLs
+			req.Header.Set("X-BUGZILLA-API-KEY", bugzillaAPIKey)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			lastErr = err
+			slog.Warn("request failed", "attempt", attempt+1, "of", 3, "err", err)
+			continue
+		}
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			_ = resp.Body.Close()
+			lastErr = fmt.Errorf("status %s", resp.Status)
+			slog.Warn("server error", "attempt", attempt+1, "of", 3, "status", resp.Status)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// ===================== Fetchers =====================
+
+// intermittentSearch returns the Bugzilla query for open intermittent bugs
+// in the triaged components.
+func intermittentSearch() url.Values {
+	params := url.Values{}
+	for _, p := range products {
+		params.Add("product", p)
+	}
+	params.Set("keywords", "intermittent-failure")
+	params.Set("keywords_type", "allwords")
+	params.Set("resolution", "---")
+	params.Set("include_fields", bugFields)
+
+	for _, c := range components {
+		params.Add("component", c)
+	}
+	return params
+}
+
+func fetchIntermittentBugs() ([]Bug, error) {
+	bugs, err := searchBugs(intermittentSearch(), "intermittents")
+	if err != nil {
+		return nil, err
+	}
+	filtered := make([]Bug, 0, len(bugs))
+	for _, b := range bugs {
+		switch {
+		case strings.Contains(strings.ToLower(b.Summary), "perma"):
+			skipped(b.ID, "perma in summary, reported as a perma")
+		case linkedTo(b, excludeLinkedTo):
+			skipped(b.ID, fmt.Sprintf("linked to bug %d", excludeLinkedTo))
+		default:
+			filtered = append(filtered, b)
+		}
+	}
+	return filtered, nil
+}
+
+// searchBugs runs a Bugzilla search page by page, since Bugzilla caps the
+// number of bugs in one response, until a page comes back short.
+func searchBugs(params url.Values, what string) ([]Bug, error) {
+	var bugs []Bug
+	for offset := 0; ; offset += bugPageSize {
+		page, err := fetchBugPage(searchURL(params, offset), what)
+		if err != nil {
+			return nil, err
+		}
+		bugs = append(bugs, page...)
+		if len(page) < bugPageSize {
+			return bugs, nil
+		}
+	}
+}
 
-func fetchTreeherderCounts(start, end string) map[int]int {
-	u := fmt.Sprintf("%s/failures/?startday=%s&endday=%s&tree=all", treeherderBase, start, end)
+// searchURL returns the URL of one page of a Bugzilla search.
+func searchURL(params url.Values, offset int) string {
+	params.Set("order", "bug_id") // a stable order keeps pages from overlapping
+	params.Set("limit", strconv.Itoa(bugPageSize))
+	params.Set("offset", strconv.Itoa(offset))
+	return bugzillaBase + "?" + params.Encode()
+}
+
+func fetchBugPage(u, what string) ([]Bug, error) {
 	resp, err := get(u)
 	if err != nil {
-		log.Fatalf("fetch treeherder counts: %v", err)
+		return nil, fmt.Errorf("fetch %s: %w", what, err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
+			slog.Warn("error closing body", "err", err)
 		}
 	}()
-	if resp.StatusCode != 200 {
-		log.Fatalf("treeherder counts: unexpected status %s", resp.Status)
-	}
 
-	var counts []THFailure
-	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
-		log.Fatalf("decode treeherder counts: %v", err)
+	var out BugListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("bad %s JSON: %w", what, err)
 	}
+	if err := out.err(); err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", what, err)
+	}
+	return out.Bugs, nil
+}
 
-	m := make(map[int]int, len(counts))
-	for _, c := range counts {
-		if c.BugID != nil {
-			m[*c.BugID] = c.BugCount
-		}
+// linkedTo reports whether b is a duplicate of, blocks or depends on the
+// bug with the given ID.
+func linkedTo(b Bug, id int) bool {
+	if id == 0 {
+		return false
 	}
-	return m
+	return b.DupeOf == id || slices.Contains(b.Blocks, id) || slices.Contains(b.DependsOn, id)
 }
 
-func fetchTreeherderBreakdown(bugID int, start, end string) (breakdowns []string, platforms []string) {
-	u := fmt.Sprintf("%s/failuresbybug/?startday=%s&endday=%s&tree=all&bug=%d", treeherderBase, start, end, bugID)
-	resp, err := get(u)
+func fetchBugsByID(ids []int) ([]Bug, error) {
+	strIDs := make([]string, len(ids))
+	for i, id := range ids {
+		strIDs[i] = strconv.Itoa(id)
+	}
+	params := url.Values{}
+	params.Set("id", strings.Join(strIDs, ","))
+	params.Set("include_fields", bugFields)
+
+	resp, err := get(bugzillaBase + "?" + params.Encode())
 	if err != nil {
-		return nil, nil
+		return nil, fmt.Errorf("fetch bugs by ID: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
+			slog.Warn("error closing body", "err", err)
 		}
 	}()
 
-	var failures []THJobFailure
-	if err := json.NewDecoder(resp.Body).Decode(&failures); err != nil {
-		return nil, nil
+	var out BugListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("bad bug JSON: %w", err)
+	}
+	if err := out.err(); err != nil {
+		return nil, fmt.Errorf("fetch bugs by ID: %w", err)
+	}
+	return out.Bugs, nil
+}
+
+// permaSearch returns the Bugzilla query for open perma bugs touched since
+// start.
+func permaSearch(start string) url.Values {
+	params := url.Values{}
+	for _, p := range products {
+		params.Add("product", p)
+	}
+	params.Set("resolution", "---")
+	params.Set("short_desc", "Perma")
+	params.Set("short_desc_type", "allwordssubstr")
+	params.Set("last_change_time", start)
+	params.Set("include_fields", bugFields)
+	params.Set("keywords", "intermittent-failure")
+
+	for _, c := range components {
+		params.Add("component", c)
+	}
+	return params
+}
+
+func fetchPermaBugs(start, end string) ([]PermaBug, error) {
+	bugs, err := searchBugs(permaSearch(start), "perma bugs")
+	if err != nil {
+		return nil, err
+	}
+	var permas []PermaBug
+	for _, b := range bugs {
+		if linkedTo(b, excludeLinkedTo) {
+			skipped(b.ID, fmt.Sprintf("linked to bug %d", excludeLinkedTo))
+			continue
+		}
+		ni := needinfoOf(b.Flags)
+
+		assignee := b.AssignedTo
+		if assignee == "nobody@mozilla.org" {
+			assignee = ""
+		}
+		graphURL := fmt.Sprintf(
+			"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
+			start, end, b.ID,
+		)
+		permas = append(permas, PermaBug{
+			ID:              b.ID,
+			Link:            showBugURL(b.ID),
+			Summary:         b.Summary,
+			Component:       b.Component,
+			Age:             bugAge(b.CreationTime),
+			Assignee:        assignee,
+			GraphLink:       graphURL,
+			Needinfo:        ni.Requestee,
+			NeedinfoSetter:  ni.Setter,
+			NeedinfoCreated: ni.CreationDate,
+			Stalled:         isStalled(b.Keywords),
+			Runbook:         runbookFor(b.Summary),
+			Note:            triageNotes[b.ID],
+			CommentCount:    b.CommentCount,
+			QAContact:       b.QAContact,
+			Verification:    verificationOf(b.Flags),
+			Priority:        priorityOf(b.Priority),
+			Whiteboard:      b.Whiteboard,
+		})
+	}
+	return permas, nil
+}
+
+func enrichPermas(permas []PermaBug, start, end, twoDayStart string, counts, twoDayCounts map[int]int) []PermaBug {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sema := make(chan struct{}, maxConcurrent)
+
+	for i, p := range permas {
+		if runCtx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sema <- struct{}{}
+
+		go func(idx int, bug PermaBug) {
+			defer wg.Done()
+			defer func() { <-sema }()
+			defer recoverAnalysis(bug.ID)
+
+			breakdowns, platforms, versions, _, _ := fetchTreeherderBreakdown(bug.ID, start, end)
+			twoDayBreakdowns, twoDayPlatforms, _, _, _ := fetchTreeherderBreakdown(bug.ID, twoDayStart, end)
+			reopened := checkReopened && fetchReopened(bug.ID, start)
+			mu.Lock()
+			permas[idx].Reopened = reopened
+			permas[idx].NumberFailures = counts[bug.ID]
+			permas[idx].TwoDayFailures = twoDayCounts[bug.ID]
+			permas[idx].BreakdownList = breakdowns
+			permas[idx].Platforms = platforms
+			permas[idx].OSVersions = versions
+			permas[idx].TwoDayBreakdown = twoDayBreakdowns
+			permas[idx].TwoDayPlatforms = twoDayPlatforms
+			mu.Unlock()
+		}(i, p)
+	}
+	wg.Wait()
+
+	filtered := permas[:0]
+	for _, p := range permas {
+		if len(p.BreakdownList) > 0 || len(p.Platforms) > 0 {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// fetchTriageOwners returns the triage owner of each component of the
+// searched products. When two products share a component name, the first
+// product listed wins. It is best-effort: a product that fails is left out,
+// and when all fail the report is rendered without owners.
+func fetchTriageOwners() map[string]string {
+	var owners map[string]string
+	for _, product := range products {
+		got, err := fetchProductOwners(product)
+		if err != nil {
+			slog.Error("fetch triage owners", "product", product, "err", err)
+			continue
+		}
+		if owners == nil {
+			owners = map[string]string{}
+		}
+		for name, owner := range got {
+			if _, ok := owners[name]; !ok {
+				owners[name] = owner
+			}
+		}
+	}
+	return owners
+}
+
+func fetchProductOwners(product string) (map[string]string, error) {
+	params := url.Values{}
+	params.Set("include_fields", "components.name,components.triage_owner")
+	u := strings.TrimSuffix(bugzillaBase, "/bug") + "/product/" + url.PathEscape(product) + "?" + params.Encode()
+	resp, err := get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
+		}
+	}()
+
+	var out ProductResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	if err := out.err(); err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	for _, p := range out.Products {
+		for _, c := range p.Components {
+			if c.TriageOwner != "" && c.TriageOwner != "nobody@mozilla.org" {
+				owners[c.Name] = c.TriageOwner
+			}
+		}
+	}
+	return owners, nil
+}
+
+// fetchReopened reports whether the bug's status went from closed back to
+// open on or after since. new_since limits the history to that window.
+func fetchReopened(bugID int, since string) bool {
+	u := fmt.Sprintf("%s/%d/history?new_since=%s", bugzillaBase, bugID, since)
+	resp, err := get(u)
+	if err != nil {
+		slog.Error("fetch history", "bug", bugID, "err", err)
+		return false
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
+		}
+	}()
+
+	var out BugHistoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		slog.Error("decode history", "bug", bugID, "err", err)
+		return false
+	}
+	if err := out.err(); err != nil {
+		slog.Error("fetch history", "bug", bugID, "err", err)
+		return false
+	}
+	closed := map[string]bool{"RESOLVED": true, "VERIFIED": true, "CLOSED": true}
+	for _, b := range out.Bugs {
+		for _, h := range b.History {
+			for _, c := range h.Changes {
+				if c.FieldName == "status" && closed[c.Removed] && !closed[c.Added] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ===================== Treeherder =====================
+
+// fetchWindowCounts fetches the current, previous and two-day failure
+// counts concurrently.
+func fetchWindowCounts(startDay, endDay, prevStartDay, twoDayStart string) (current, prev, twoDay map[int]int, err error) {
+	var currentErr, prevErr, twoDayErr error
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); current, currentErr = fetchTreeherderCounts(startDay, endDay) }()
+	go func() { defer wg.Done(); prev, prevErr = fetchTreeherderCounts(prevStartDay, startDay) }()
+	go func() { defer wg.Done(); twoDay, twoDayErr = fetchTreeherderCounts(twoDayStart, endDay) }()
+	wg.Wait()
+	return current, prev, twoDay, errors.Join(currentErr, prevErr, twoDayErr)
+}
+
+// fetchTreeherderCounts returns failure counts per bug across all trees, or
+// summed over --count-trees when set.
+func fetchTreeherderCounts(start, end string) (map[int]int, error) {
+	if len(countTrees) == 0 {
+		return fetchTreeCounts(start, end, "all")
+	}
+	m := map[int]int{}
+	for _, tree := range countTrees {
+		counts, err := fetchTreeCounts(start, end, tree)
+		if err != nil {
+			return nil, err
+		}
+		for id, c := range counts {
+			m[id] += c
+		}
+	}
+	return m, nil
+}
+
+func fetchTreeCounts(start, end, tree string) (map[int]int, error) {
+	u := fmt.Sprintf("%s/failures/?startday=%s&endday=%s&tree=%s", treeherderBase, start, end, url.QueryEscape(tree))
+	resp, err := get(u)
+	if err != nil {
+		return nil, fmt.Errorf("fetch treeherder counts: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
+		}
+	}()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("treeherder counts: unexpected status %s", resp.Status)
+	}
+
+	var counts []THFailure
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		return nil, fmt.Errorf("decode treeherder counts: %w", err)
+	}
+
+	m := make(map[int]int, len(counts))
+	for _, c := range counts {
+		if c.BugID != nil {
+			m[*c.BugID] = c.BugCount
+		}
+	}
+	return m, nil
+}
+
+// fetchTreeherderBreakdown returns the bug's repository and platform
+// breakdowns over the window and the OS versions it failed on, plus the push
+// times of its earliest and latest failures.
+func fetchTreeherderBreakdown(bugID int, start, end string) (breakdowns []string, platforms []PlatformCount, versions []PlatformInfo, first, last time.Time) {
+	failures, err := fetchFailuresByBug(bugID, start, end)
+	if err != nil {
+		noteAnalysisError(bugID, fmt.Errorf("failure breakdown: %w", err))
+		return nil, nil, nil, time.Time{}, time.Time{}
+	}
+	breakdowns, platforms, versions = aggregateBreakdown(failures)
+	first, last = failureSpan(failures)
+	return breakdowns, platforms, versions, first, last
+}
+
+func fetchFailuresByBug(bugID int, start, end string) ([]THJobFailure, error) {
+	u := fmt.Sprintf("%s/failuresbybug/?startday=%s&endday=%s&tree=all&bug=%d", treeherderBase, start, end, bugID)
+	return fetchTreeherderJSON[[]THJobFailure](u, fmt.Sprintf("failuresbybug-%d-%s-%s", bugID, start, end), end)
+}
+
+// fetchTreeherderJSON GETs and decodes a per-bug Treeherder response for a
+// window ending on end, serving it from the disk cache under --cache while
+// the entry is fresh enough (see treeherderCacheTTL).
+func fetchTreeherderJSON[T any](u, cacheKey, end string) (T, error) {
+	var out T
+	path := filepath.Join(cacheDir, "treeherder", cacheKey+".json")
+	useCache := treeherderCache && !noCache
+	if useCache && readCache(path, treeherderCacheTTL(end, time.Now()), &out) {
+		return out, nil
+	}
+	resp, err := get(u)
+	if err != nil {
+		return out, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
+		}
+	}()
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return out, err
+	}
+	if useCache {
+		writeCache(path, out)
+	}
+	return out, nil
+}
+
+// todayCacheTTL bounds how long a cached window that includes today is
+// reused: today's failures keep arriving while the /failures/ counts are
+// always fetched fresh, so a longer TTL would pair current counts with an
+// old breakdown.
+const todayCacheTTL = 10 * time.Minute
+
+// treeherderCacheTTL is how old a cache entry for a window ending on end may
+// be. Windows ending before today hold settled data, so entries written
+// since UTC midnight stay valid; windows reaching today only for
+// todayCacheTTL.
+func treeherderCacheTTL(end string, now time.Time) time.Duration {
+	now = now.UTC()
+	ttl := now.Sub(now.Truncate(24 * time.Hour))
+	if end >= now.Format("2006-01-02") {
+		ttl = min(ttl, todayCacheTTL)
+	}
+	return ttl
+}
+
+// fetchFailureRate returns the bug's failure rate over the window along with
+// the number of test runs it was measured against, or "" and 0 when
+// Treeherder has no run data.
+func fetchFailureRate(bugID int, start, end string) (string, int) {
+	u := fmt.Sprintf("%s/failurecount/?startday=%s&endday=%s&tree=all&bug=%d", treeherderBase, start, end, bugID)
+	days, err := fetchTreeherderJSON[[]THDailyCount](u, fmt.Sprintf("failurecount-%d-%s-%s", bugID, start, end), end)
+	if err != nil {
+		noteAnalysisError(bugID, fmt.Errorf("failure rate: %w", err))
+		return "", 0
+	}
+
+	var totalRuns, totalFailures int
+	for _, d := range days {
+		totalRuns += d.TestRuns
+		totalFailures += d.FailureCount
+	}
+	if totalRuns == 0 {
+		return "", 0
+	}
+	return fmt.Sprintf("%.1f%%", float64(totalFailures)/float64(totalRuns)*100), totalRuns
+}
+
+// failureSpan returns the earliest and latest push times among failures, or
+// zero times when none is parseable.
+func failureSpan(failures []THJobFailure) (first, last time.Time) {
+	for _, f := range failures {
+		t, err := time.Parse(time.DateTime, f.PushTime)
+		if err != nil {
+			continue
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	return first, last
+}
+
+// failuresPerDay spreads n failures over the days the bug was actually
+// failing: from its first failure in the window (or the window start when
+// that is unknown) to the window end. A bug that started failing two days
+// ago then outranks one with the same count spread over the week.
+func failuresPerDay(n int, start, end string, first time.Time) float64 {
+	from, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return 0
+	}
+	to, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return 0
+	}
+	if first.After(from) {
+		from = first.Truncate(24 * time.Hour)
+	}
+	return float64(n) / max(to.Sub(from).Hours()/24, 1)
+}
+
+// aggregateBreakdown counts failures per repository and normalized
+// platform. The OS versions are parsed from the raw platform names, since
+// normalization drops the Android version and Windows build.
+func aggregateBreakdown(failures []THJobFailure) (breakdowns []string, platforms []PlatformCount, versions []PlatformInfo) {
+	treeCounts := map[string]int{}
+	platformCounts := map[string]int{}
+	for _, f := range failures {
+		treeCounts[f.Tree]++
+		platformStr := f.Platform
+		if strings.EqualFold(platformStr, "toolchains") {
+			platformStr = f.TestSuite
+		}
+		if p := normalizePlatform(platformStr); p != "" {
+			platformCounts[p]++
+		}
+		if v := parsePlatform(platformStr); v.Family != "" && !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].String() < versions[j].String() })
+
+	for tree, count := range treeCounts {
+		breakdowns = append(breakdowns, fmt.Sprintf("%s: %d", tree, count))
+	}
+	sortRepos(breakdowns)
+
+	for p, count := range platformCounts {
+		platforms = append(platforms, PlatformCount{Name: p, Count: count})
+	}
+	// the platforms a bug fails on most come first; ties stay alphabetical
+	sort.Slice(platforms, func(i, j int) bool {
+		if platforms[i].Count != platforms[j].Count {
+			return platforms[i].Count > platforms[j].Count
+		}
+		return platforms[i].Name < platforms[j].Name
+	})
+	return
+}
+
+// PlatformCount is a platform a bug failed on and how many times.
+type PlatformCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// String renders the entry as "name: N", as the reports show it.
+func (p PlatformCount) String() string {
+	return fmt.Sprintf("%s: %d", p.Name, p.Count)
+}
+
+// UnmarshalJSON also accepts the "name: N" strings that older --format json
+// reports hold, so they keep working with --compare.
+func (p *PlatformCount) UnmarshalJSON(data []byte) error {
+	var legacy string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		type plain PlatformCount // drops the method to avoid recursing
+		return json.Unmarshal(data, (*plain)(p))
+	}
+	name, count, _ := strings.Cut(legacy, ":")
+	p.Name = strings.TrimSpace(name)
+	p.Count, _ = strconv.Atoi(strings.TrimSpace(count))
+	return nil
+}
+
+// platformStrings renders platforms as "name: N" lines.
+func platformStrings(platforms []PlatformCount) []string {
+	out := make([]string, len(platforms))
+	for i, p := range platforms {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// breakdownTotal sums the counts of "name: N" breakdown lines. The count is
+// whatever follows the last colon, so names may contain colons, and
+// thousands separators are ignored.
+func breakdownTotal(lines []string) int {
+	total := 0
+	for _, l := range lines {
+		i := strings.LastIndex(l, ":")
+		if i < 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(l[i+1:]), ",", "")); err == nil {
+			total += n
+		}
+	}
+	return total
+}
+
+// countsDisagree reports whether the /failures/ count and the breakdown sum
+// differ by more than a couple of failures and more than 10%, which usually
+// means one of the two endpoints is returning stale or partial data.
+func countsDisagree(count, sum int) bool {
+	diff := count - sum
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff > 2 && diff*10 > count
+}
+
+// PlatformInfo is a Treeherder platform split into its OS components.
+type PlatformInfo struct {
+	Family  string `json:"family"`            // android, linux, macosx or windows
+	Version string `json:"version,omitempty"` // e.g. 11, 1804, 1470, 14.0
+	Build   string `json:"build,omitempty"`   // Windows build such as 2009 or 24h2
+}
+
+// String renders the version as --os-version takes it, followed by the
+// build, e.g. "windows11 24h2" or "android14.0".
+func (p PlatformInfo) String() string {
+	if p.Build != "" {
+		return p.Family + p.Version + " " + p.Build
+	}
+	return p.Family + p.Version
+}
+
+// platformFamilies maps the leading keyword of a Treeherder platform name to
+// its OS family. Bare Android device names (a51, p6, ...) map to android.
+// Both normalization and grouping go through it, so add to it when
+// Treeherder grows a new naming scheme; unrecognized names are reported
+// as-is rather than grouped.
+var platformFamilies = map[string]string{
+	"android": "android",
+	"a51":     "android",
+	"a55":     "android",
+	"p5":      "android",
+	"p6":      "android",
+	"pixel":   "android",
+	"s21":     "android",
+	"s24":     "android",
+	"linux":   "linux",
+	"ubuntu":  "linux",
+	"macosx":  "macosx",
+	"macos":   "macosx",
+	"mac":     "macosx",
+	"osx":     "macosx",
+	"windows": "windows",
+	"win":     "windows",
+}
+
+var platformKeywordRe = regexp.MustCompile(`^([a-z]+)(\d*)$`)
+
+// platformFamily returns the OS family of one "-"-separated platform token
+// along with the version digits following its keyword, or "" when the token
+// isn't a platformFamilies keyword.
+func platformFamily(token string) (family, version string) {
+	if family, ok := platformFamilies[token]; ok {
+		// a device name such as a51, whose digits aren't an OS version
+		return family, ""
+	}
+	if m := platformKeywordRe.FindStringSubmatch(token); m != nil && platformFamilies[m[1]] != "" {
+		return platformFamilies[m[1]], m[2]
+	}
+	return "", ""
+}
+
+// parsePlatform extracts the OS family, version and (for Windows) build from
+// platform strings such as "windows11-64-24h2-shippable",
+// "linux2404-64-shippable" or "android-hw-a55-14-0-arm64-shippable".
+func parsePlatform(platform string) PlatformInfo {
+	parts := strings.Split(strings.ToLower(platform), "-")
+	var info PlatformInfo
+	if info.Family, info.Version = platformFamily(parts[0]); info.Family == "" {
+		return PlatformInfo{}
+	}
+	switch info.Family {
+	case "android":
+		// android-hw-p6-13-0-...: the version is the first pair of numeric tokens
+		for i := 1; i+1 < len(parts); i++ {
+			if isDigits(parts[i]) && isDigits(parts[i+1]) {
+				info.Version = parts[i] + "." + parts[i+1]
+				break
+			}
+		}
+	case "windows":
+		// windows11-64-2009-...: skip the bitness, then take a year/half-year build token
+		for _, p := range parts[1:] {
+			if p != "32" && p != "64" && p != "aarch64" && windowsBuildRe.MatchString(p) {
+				info.Build = p
+				break
+			}
+		}
+	}
+	return info
+}
+
+var windowsBuildRe = regexp.MustCompile(`^\d{2}(\d{2}|h\d)$`)
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesOSVersion reports whether any version has the given
+// family+version, e.g. "windows11" or "android14.0". A dotted version also
+// matches on its major part, so "android14" works too.
+func matchesOSVersion(versions []PlatformInfo, want string) bool {
+	for _, v := range versions {
+		major, _, _ := strings.Cut(v.Version, ".")
+		if v.Version != "" && (strings.EqualFold(v.Family+v.Version, want) || strings.EqualFold(v.Family+major, want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchingPlatforms returns the platforms whose name contains one of filters,
+// or whose OS family is one of them, so "windows" also keeps "win"
+// platforms. Matching is case-insensitive.
+func matchingPlatforms(platforms []PlatformCount, filters []string) []PlatformCount {
+	var out []PlatformCount
+	for _, p := range platforms {
+		name := strings.ToLower(p.Name)
+		family := parsePlatform(name).Family
+		for _, f := range filters {
+			f = strings.ToLower(f)
+			if strings.Contains(name, f) || (family != "" && family == parsePlatform(f).Family) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// sortRepos orders "repo: N" breakdown lines by their position in repoOrder,
+// falling back to alphabetical order. Repos missing from repoOrder are placed
+// at its "*" entry, or after every listed repo when there is none.
+func sortRepos(lines []string) {
+	rank := func(line string) int {
+		name, _, _ := strings.Cut(line, ":")
+		other := len(repoOrder)
+		for i, r := range repoOrder {
+			if r == name {
+				return i
+			}
+			if r == "*" {
+				other = i
+			}
+		}
+		return other
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		ri, rj := rank(lines[i]), rank(lines[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return lines[i] < lines[j]
+	})
+}
+
+func normalizePlatform(platform string) string {
+	// stray whitespace would otherwise split one platform into several
+	// entries of the aggregated breakdown
+	p := strings.ToLower(strings.Join(strings.Fields(platform), "-"))
+	if p == "" {
+		return ""
+	}
+	parts := strings.Split(p, "-")
+	switch family, _ := platformFamily(parts[0]); family {
+	case "":
+		// Fallback for strings like "toolchain-linux64-custom-car"
+		for _, part := range parts[1:] {
+			if family, _ := platformFamily(part); family != "" {
+				return family
+			}
+		}
+		return p
+	case "android":
+		if parts[0] == "android" && len(parts) >= 3 {
+			return strings.Join(parts[:3], "-") // e.g. android-hw-p6, android-hw-a55
+		}
+		return parts[0] // a bare device name such as a51
+	default:
+		return parts[0] // e.g. linux2404, macosx1470, windows11
+	}
+}
+
+// ===================== Analyzer =====================
+
+func analyzeAll(bugs []Bug, start, end string, counts, prevCounts map[int]int, twoDayStart string, twoDayCounts map[int]int) []Result {
+	if len(bugs) == 0 {
+		return nil
+	}
+
+	// a threshold of 0 still requires a failure in the window; only explicit
+	// bug lists (threshold -1) report bugs that didn't fail at all
+	var qualifying []Bug
+	for _, b := range bugs {
+		if c := counts[b.ID]; threshold < 0 || c >= max(threshold, 1) {
+			qualifying = append(qualifying, b)
+		} else {
+			slog.Debug("skipping bug", "bug", b.ID, "reason", "below threshold", "failures", c, "threshold", max(threshold, 1))
+		}
+	}
+	return analyzeBugs(qualifying, start, end, counts, prevCounts, twoDayStart, twoDayCounts)
+}
+
+// percentileThreshold returns the pth percentile (nearest rank) of the
+// failure counts of the bugs that failed at all in the window, so the
+// threshold tracks overall flakiness instead of a fixed number.
+func percentileThreshold(bugs []Bug, counts map[int]int, p float64) int {
+	var failing []int
+	for _, b := range bugs {
+		if c := counts[b.ID]; c > 0 {
+			failing = append(failing, c)
+		}
+	}
+	if len(failing) == 0 {
+		return threshold
+	}
+	sort.Ints(failing)
+	return nearestRank(failing, p)
+}
+
+// nearestRank returns the pth percentile of sorted, which must not be empty.
+func nearestRank(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// FailureStats is the distribution of failure counts across the reported
+// intermittents, so a bug's count can be read against the week's noise.
+type FailureStats struct {
+	Median int
+	P90    int
+}
+
+// annotateOutliers computes the median and 90th percentile (nearest rank) of
+// the results' failure counts and marks the results above the p90.
+func annotateOutliers(results []Result) FailureStats {
+	if len(results) == 0 {
+		return FailureStats{}
+	}
+	counts := make([]int, len(results))
+	for i, r := range results {
+		counts[i] = r.NumberFailures
+	}
+	sort.Ints(counts)
+	stats := FailureStats{Median: nearestRank(counts, 50), P90: nearestRank(counts, 90)}
+	for i := range results {
+		results[i].AboveP90 = results[i].NumberFailures > stats.P90
+	}
+	return stats
+}
+
+// missingBreakdowns returns the IDs of results that have failures but neither
+// platforms nor a repository breakdown, which means /failures/ and
+// /failuresbybug/ disagree about the bug.
+func missingBreakdowns(results []Result) []int {
+	var ids []int
+	for _, r := range results {
+		if r.NumberFailures > 0 && len(r.Platforms) == 0 && len(r.BreakdownList) == 0 {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// analyzeBelowThreshold analyzes the bugs that failed in the window but not
+// often enough to reach the threshold.
+func analyzeBelowThreshold(bugs []Bug, start, end string, counts, prevCounts map[int]int, twoDayStart string, twoDayCounts map[int]int) []Result {
+	var below []Bug
+	for _, b := range bugs {
+		if c := counts[b.ID]; c > 0 && c < threshold {
+			below = append(below, b)
+		}
+	}
+	return analyzeBugs(below, start, end, counts, prevCounts, twoDayStart, twoDayCounts)
+}
+
+// AnalysisFailure records a bug whose Treeherder details could not be
+// fetched, so it is reported with partial data rather than silently.
+type AnalysisFailure struct {
+	ID     int    `json:"id"`
+	Reason string `json:"reason"`
+}
+
+var analysisErrors struct {
+	sync.Mutex
+	byBug map[int]string
+}
+
+// noteAnalysisError keeps the first error seen for each bug. Errors caused by
+// --max-runtime cancelling the run are already reported as a partial report.
+func noteAnalysisError(bugID int, err error) {
+	if runCtx.Err() != nil {
+		return
+	}
+	analysisErrors.Lock()
+	defer analysisErrors.Unlock()
+	if analysisErrors.byBug == nil {
+		analysisErrors.byBug = map[int]string{}
+	}
+	if _, ok := analysisErrors.byBug[bugID]; !ok {
+		analysisErrors.byBug[bugID] = err.Error()
+	}
+}
+
+// recoverAnalysis is deferred by each per-bug goroutine so one pathological
+// bug is reported as unanalyzed instead of crashing the whole run.
+func recoverAnalysis(bugID int) {
+	if p := recover(); p != nil {
+		slog.Error("analysis panicked", "bug", bugID, "panic", p)
+		noteAnalysisError(bugID, fmt.Errorf("panic: %v", p))
+	}
+}
+
+// analysisFailures returns the recorded errors ordered by bug ID.
+func analysisFailures() []AnalysisFailure {
+	analysisErrors.Lock()
+	defer analysisErrors.Unlock()
+	out := make([]AnalysisFailure, 0, len(analysisErrors.byBug))
+	for id, reason := range analysisErrors.byBug {
+		out = append(out, AnalysisFailure{ID: id, Reason: reason})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// progress counts analyzed bugs across every concurrent analyzeBugs call so
+// long runs show they are still moving.
+var progress struct{ done, total atomic.Int32 }
+
+// resetRun clears the per-run state so a --serve regeneration doesn't carry
+// over the previous run's failures, progress or notes.
+func resetRun() {
+	analysisErrors.Lock()
+	analysisErrors.byBug = nil
+	analysisErrors.Unlock()
+	progress.done.Store(0)
+	progress.total.Store(0)
+	timeLimited = false
+	truncatedFrom = 0
+	hiddenNeedinfo = 0
+	failedSearches = nil
+	failureStats = FailureStats{}
+}
+
+func reportProgress() {
+	n := progress.done.Add(1)
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "\ranalyzed %d/%d bugs", n, progress.total.Load())
+	}
+}
+
+func analyzeBugs(qualifying []Bug, start, end string, counts, prevCounts map[int]int, twoDayStart string, twoDayCounts map[int]int) []Result {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var results []Result
+	sema := make(chan struct{}, maxConcurrent)
+	progress.total.Add(int32(len(qualifying)))
+
+	for _, bug := range qualifying {
+		if runCtx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		sema <- struct{}{}
+
+		go func(b Bug) {
+			defer wg.Done()
+			defer func() { <-sema }()
+			defer reportProgress()
+			defer recoverAnalysis(b.ID)
+
+			breakdowns, platforms, versions, first, last := fetchTreeherderBreakdown(b.ID, start, end)
+			rate, testRuns := fetchFailureRate(b.ID, start, end)
+			if crossCheck {
+				if sum := breakdownTotal(breakdowns); countsDisagree(counts[b.ID], sum) {
+					slog.Warn("cross-check: failure count disagrees with the breakdown", "bug", b.ID, "failures", counts[b.ID], "breakdown", sum)
+				}
+			}
+
+			twoDayCount := twoDayCounts[b.ID]
+			var twoDayRate string
+			var twoDayBreakdowns []string
+			var twoDayPlatforms []PlatformCount
+			if twoDayCount > 0 {
+				twoDayRate, _ = fetchFailureRate(b.ID, twoDayStart, end)
+				twoDayBreakdowns, twoDayPlatforms, _, _, _ = fetchTreeherderBreakdown(b.ID, twoDayStart, end)
+			}
+
+			ni := needinfoOf(b.Flags)
+			reopened := checkReopened && fetchReopened(b.ID, start)
+
+			assigned := b.AssignedTo
+			if assigned == "nobody@mozilla.org" || assigned == "" {
+				assigned = ""
+			}
+
+			graphLink := fmt.Sprintf(
+				"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
+				start, end, b.ID,
+			)
+
+			baseline, hasBaseline := baselineFor(b.ID, b.Component)
+
+			mu.Lock()
+			results = append(results, Result{
+				ID:              b.ID,
+				Link:            showBugURL(b.ID),
+				NumberFailures:  counts[b.ID],
+				FailuresPerDay:  failuresPerDay(counts[b.ID], start, end, first),
+				Summary:         b.Summary,
+				Component:       b.Component,
+				Age:             bugAge(b.CreationTime),
+				Rate:            rate,
+				TestRuns:        testRuns,
+				Trend:           computeTrend(counts[b.ID], prevCounts[b.ID]),
+				TwoDay:          twoDayCount,
+				TwoDayRate:      twoDayRate,
+				TwoDayPlatforms: twoDayPlatforms,
+				TwoDayBreakdown: twoDayBreakdowns,
+				Platforms:       platforms,
+				OSVersions:      versions,
+				BreakdownList:   breakdowns,
+				Needinfo:        ni.Requestee,
+				NeedinfoSetter:  ni.Setter,
+				NeedinfoCreated: ni.CreationDate,
+				GraphLink:       graphLink,
+				Assignee:        assigned,
+				Stalled:         isStalled(b.Keywords),
+				Reopened:        reopened,
+				Runbook:         runbookFor(b.Summary),
+				Note:            triageNotes[b.ID],
+				CommentCount:    b.CommentCount,
+				QAContact:       b.QAContact,
+				Verification:    verificationOf(b.Flags),
+				Priority:        priorityOf(b.Priority),
+				Whiteboard:      b.Whiteboard,
+				HasBaseline:     hasBaseline,
+				Baseline:        baseline,
+				OverBaseline:    counts[b.ID] - baseline,
+				WindowStart:     start,
+				WindowEnd:       end,
+				LastFailure:     last,
+			})
+			mu.Unlock()
+		}(bug)
+	}
+	wg.Wait()
+
+	// goroutines finish in any order, so ties are broken by bug ID to keep
+	// the rendered report stable between runs
+	sort.Slice(results, func(i, j int) bool { return resultLess(results[i], results[j]) })
+	return results
+}
+
+// resultLess orders results by sortKey. Ties, and the default "failures"
+// key, fall back to most failures first and then bug ID, so the order is
+// stable from run to run.
+func resultLess(a, b Result) bool {
+	switch sortKey {
+	case "id":
+		return a.ID < b.ID
+	case "assignee":
+		// unassigned bugs go last so the owned, actionable ones surface
+		if (a.Assignee == "") != (b.Assignee == "") {
+			return b.Assignee == ""
+		}
+		if a.Assignee != b.Assignee {
+			return a.Assignee < b.Assignee
+		}
+	case "summary":
+		if a.Summary != b.Summary {
+			return a.Summary < b.Summary
+		}
+	case "per-day":
+		if a.FailuresPerDay != b.FailuresPerDay {
+			return a.FailuresPerDay > b.FailuresPerDay
+		}
+	}
+	if a.NumberFailures != b.NumberFailures {
+		return a.NumberFailures > b.NumberFailures
+	}
+	return a.ID < b.ID
+}
+
+// ===================== Task Timeout =====================
+
+func filterPerfFailures(failures []THJobFailure) []THJobFailure {
+	var perf []THJobFailure
+	for _, f := range failures {
+		suite := strings.ToLower(f.TestSuite)
+		for _, kw := range perfTestKeywords {
+			if strings.Contains(suite, kw) {
+				perf = append(perf, f)
+				break
+			}
+		}
+	}
+	return perf
+}
+
+func treeBreakdownFrom(failures []THJobFailure) []string {
+	counts := map[string]int{}
+	for _, f := range failures {
+		counts[f.Tree]++
+	}
+	var out []string
+	for tree, count := range counts {
+		out = append(out, fmt.Sprintf("%s: %d", tree, count))
+	}
+	sortRepos(out)
+	return out
+}
+
+// platformBreakdownFrom counts failures per normalized platform, most first.
+func platformBreakdownFrom(failures []THJobFailure) []PlatformCount {
+	_, platforms, _ := aggregateBreakdown(failures)
+	return platforms
+}
+
+func suiteBreakdownFrom(perf []THJobFailure) []string {
+	counts := map[string]int{}
+	for _, f := range perf {
+		counts[f.TestSuite]++
+	}
+	var out []string
+	for suite, count := range counts {
+		out = append(out, fmt.Sprintf("%s: %d", suite, count))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func fetchRawBreakdown(bugID int, start, end string) []THJobFailure {
+	failures, err := fetchFailuresByBug(bugID, start, end)
+	if err != nil {
+		slog.Error("fetch breakdown", "bug", bugID, "err", err)
+		return nil
+	}
+	return failures
+}
+
+func analyzeTaskTimeout(start, end, twoDayStart string) *TaskTimeoutReport {
+	perf := filterPerfFailures(fetchRawBreakdown(taskTimeoutBugID, start, end))
+	if len(perf) < max(threshold, 1) {
+		return nil
+	}
+	twoDayPerf := filterPerfFailures(fetchRawBreakdown(taskTimeoutBugID, twoDayStart, end))
+
+	return &TaskTimeoutReport{
+		Link: showBugURL(taskTimeoutBugID),
+		GraphLink: fmt.Sprintf(
+			"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
+			start, end, taskTimeoutBugID,
+		),
+		PerfFailures:         len(perf),
+		SuiteBreakdown:       suiteBreakdownFrom(perf),
+		TreeBreakdown:        treeBreakdownFrom(perf),
+		Platforms:            platformBreakdownFrom(perf),
+		TwoDayPerfFailures:   len(twoDayPerf),
+		TwoDaySuiteBreakdown: suiteBreakdownFrom(twoDayPerf),
+		TwoDayTreeBreakdown:  treeBreakdownFrom(twoDayPerf),
+		TwoDayPlatforms:      platformBreakdownFrom(twoDayPerf),
+	}
+}
+
+var examples = []struct {
+	Desc string
+	Args string
+}{
+	{"Weekly report, only bugs with 50+ failures, without opening a browser", "--threshold 50 --no-open"},
+	{"Weekly Talos-only report of bugs with 50+ failures, posted to Slack", "--components Talos --threshold 50 --no-open --slack-webhook https://hooks.slack.com/services/T000/B000/XXXX"},
+	{"JSON export for a dashboard", "--format json --output triage.json --no-open"},
+	{"One scheduled job: HTML kept locally, JSON uploaded, Slack notified", "--format html,json --upload-format json --upload-url 'https://bucket.example/report.json?sig=XXXX' --slack-webhook https://hooks.slack.com/services/T000/B000/XXXX --no-open"},
+	{"Check the Bugzilla searches without running them", "--dry-run"},
+	{"Catch up after two weeks away, grouped by platform", "--days 14 --group-by platform"},
+	{"Android-only triage on the trees we gate on", "--platform android --count-trees autoland,mozilla-central"},
+	{"Spot-check a single bug from the report", "--bug 1809667"},
+	{"Report on the bugs raised in a meeting", "--bug-ids 1234567,2345678"},
+	{"Cron job bounded to five minutes", "--no-open --max-runtime 5m --concurrency 25"},
+}
+
+func printExamples(w io.Writer) {
+	for _, ex := range examples {
+		_, _ = fmt.Fprintf(w, "# %s\ngo run main.go %s\n\n", ex.Desc, ex.Args)
+	}
+}
+
+func parseFile[T any](path string, parse func(io.Reader) (T, error)) (T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	defer func() { _ = f.Close() }()
+	return parse(f)
+}
+
+// ===================== Cache =====================
+
+// cachedTriageOwners returns the triage owners from the on-disk cache when
+// it is younger than metadataTTL, fetching and re-caching them otherwise.
+// Owners change rarely, so frequent runs needn't hit the product endpoint.
+func cachedTriageOwners() map[string]string {
+	// keyed by product so changing --products doesn't reuse the wrong owners
+	path := filepath.Join(cacheDir, "triage-owners-"+url.PathEscape(strings.Join(products, ","))+".json")
+	var owners map[string]string
+	if !refreshMetadata && readCache(path, metadataTTL, &owners) {
+		return owners
+	}
+	owners = fetchTriageOwners()
+	if owners != nil {
+		writeCache(path, owners)
+	}
+	return owners
+}
+
+// readCache decodes the JSON cache file at path into v, reporting false when
+// caching is disabled or the file is missing, stale or unreadable.
+func readCache(path string, ttl time.Duration, v any) bool {
+	if cacheDir == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// writeCache stores v as JSON at path. Failures only warn: the cache is an
+// optimisation, never a requirement.
+func writeCache(path string, v any) {
+	if cacheDir == "" {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Warn("encode cache", "path", path, "err", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		slog.Warn("create cache dir", "err", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		slog.Warn("write cache", "path", path, "err", err)
+	}
+}
+
+// ===================== Runbooks =====================
+
+// parseRunbooks reads "pattern URL" lines, skipping blanks and # comments.
+// Patterns are case-insensitive globs matched against the whole bug summary,
+// where * matches any run of characters (including /) and ? a single one.
+func parseRunbooks(r io.Reader) ([]runbook, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []runbook
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want \"pattern URL\", got %q", i+1, line)
+		}
+		expr := regexp.QuoteMeta(fields[0])
+		expr = strings.ReplaceAll(expr, `\*`, ".*")
+		expr = strings.ReplaceAll(expr, `\?`, ".")
+		out = append(out, runbook{
+			Pattern: regexp.MustCompile("(?i)^" + expr + "$"),
+			URL:     fields[1],
+		})
+	}
+	return out, nil
+}
+
+// runbookFor returns the URL of the first runbook whose pattern matches the summary.
+func runbookFor(summary string) string {
+	for _, rb := range runbooks {
+		if rb.Pattern.MatchString(summary) {
+			return rb.URL
+		}
+	}
+	return ""
+}
+
+// ===================== Notes =====================
+
+// triageNotes holds free-form triage notes keyed by bug ID, loaded from --notes.
+var triageNotes map[int]string
+
+// parseNotes reads "<bug ID> <note text>" lines, skipping blanks and # comments.
+// A bug listed more than once keeps its last note.
+func parseNotes(r io.Reader) (map[int]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out := map[int]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idStr, note, _ := strings.Cut(line, " ")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad bug ID %q", i+1, idStr)
+		}
+		out[id] = strings.TrimSpace(note)
+	}
+	return out, nil
+}
+
+// ===================== Baselines =====================
+
+// baselines maps a bug ID or component name to its expected failure count
+// per window, loaded from --baselines.
+var baselines map[string]int
+
+// parseBaselines reads "<bug ID or component> <failures>" lines, skipping
+// blanks and # comments.
+func parseBaselines(r io.Reader) (map[string]int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]int{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want \"key failures\", got %q", i+1, line)
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("line %d: bad baseline %q", i+1, fields[1])
+		}
+		out[fields[0]] = n
+	}
+	return out, nil
+}
+
+// baselineFor returns the bug's own baseline, falling back to its component's.
+func baselineFor(bugID int, component string) (int, bool) {
+	if n, ok := baselines[strconv.Itoa(bugID)]; ok {
+		return n, true
+	}
+	n, ok := baselines[component]
+	return n, ok
+}
+
+// ===================== Bug detail =====================
+
+func printBugDetail(w io.Writer, r Result) {
+	_, _ = fmt.Fprintf(w, "Bug %d - %s\n", r.ID, r.Summary)
+	_, _ = fmt.Fprintf(w, "  %s\n", r.Link)
+	line := func(label, value string) {
+		if value != "" {
+			_, _ = fmt.Fprintf(w, "  %-18s %s\n", label+":", value)
+		}
+	}
+	list := func(label string, values []string) {
+		if len(values) > 0 {
+			line(label, strings.Join(values, ", "))
+		}
+	}
+	line("Component", r.Component)
+	failures := fmt.Sprintf("%d", r.NumberFailures)
+	if r.Rate != "" {
+		failures += fmt.Sprintf(" (%s rate over %d runs)", r.Rate, r.TestRuns)
+	}
+	if r.Trend != "" {
+		failures += " " + r.Trend
+	}
+	if r.HasBaseline {
+		failures += fmt.Sprintf(", %+d vs baseline of %d", r.OverBaseline, r.Baseline)
+	}
+	line(fmt.Sprintf("%dd failures", daysBack), failures)
+	list("Platforms", platformStrings(r.Platforms))
+	var versions []string
+	for _, v := range r.OSVersions {
+		versions = append(versions, v.String())
+	}
+	list("OS versions", versions)
+	list("Repositories", r.BreakdownList)
+	if r.TwoDay > 0 {
+		twoDay := fmt.Sprintf("%d", r.TwoDay)
+		if r.TwoDayRate != "" {
+			twoDay += fmt.Sprintf(" (%s rate)", r.TwoDayRate)
+		}
+		line("2d failures", twoDay)
+		list("2d platforms", platformStrings(r.TwoDayPlatforms))
+		list("2d repositories", r.TwoDayBreakdown)
+	}
+	line("Opened", r.Age)
+	if r.CommentCount > 0 {
+		line("Comments", strconv.Itoa(r.CommentCount))
+	}
+	line("Assigned to", r.Assignee)
+	line("QA contact", r.QAContact)
+	line("Priority", r.Priority)
+	line("Whiteboard", r.Whiteboard)
+	if r.Verification != "" {
+		line("qe-verify", r.Verification)
+	}
+	if r.Needinfo != "" && r.NeedinfoSetter != "" {
+		line("NEEDINFO", fmt.Sprintf("%s (requested by %s)", r.Needinfo, r.NeedinfoSetter))
+	} else {
+		line("NEEDINFO", r.Needinfo)
+	}
+	if r.Stalled {
+		line("Status", "stalled")
+	}
+	if r.Reopened {
+		line("Status", "reopened in window")
+	}
+	line("Note", r.Note)
+	line("Runbook", r.Runbook)
+	line("Graph", r.GraphLink)
+}
+
+// ===================== HTML =====================
+
+// distinctPlatforms returns the sorted union of platform names across the
+// report, dropping the per-platform counts.
+func distinctPlatforms(results []Result, permas []PermaBug) []string {
+	seen := map[string]bool{}
+	add := func(entries []PlatformCount) {
+		for _, e := range entries {
+			seen[e.Name] = true
+		}
+	}
+	for _, r := range results {
+		add(r.Platforms)
+	}
+	for _, p := range permas {
+		add(p.Platforms)
+	}
+	out := make([]string, 0, len(seen))
+	for name := range seen {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var cssColorRe = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]+)$`)
+
+type reportData struct {
+	Intermittents  []ComponentGroup[Result]
+	BelowThreshold []ComponentGroup[Result]
+	Permas         []ComponentGroup[PermaBug]
+	TaskTimeout    *TaskTimeoutReport
+	Generated      string
+	DaysBack       int
+	LogoURL        string
+	AccentColor    string
+	Platforms      []string
+	TimeLimited    bool
+	NeedinfoAging  NeedinfoAging
+	Threshold      int
+	Percentile     float64
+	Lang           string
+	Resolved       []Result
+	Failed         []AnalysisFailure
+	Summary        ReportSummary
+	TruncatedFrom  int
+	HiddenNeedinfo int
+	FailedSearches []string
+	Stats          FailureStats
+}
+
+// ReportSummary holds the at-a-glance totals shown at the top of the report.
+type ReportSummary struct {
+	Intermittents int
+	Permas        int
+	Failures      int
+	Unassigned    int
+	Needinfo      int
+}
+
+func summarize(results []Result, permas []PermaBug) ReportSummary {
+	s := ReportSummary{Intermittents: len(results), Permas: len(permas)}
+	for _, r := range results {
+		s.Failures += r.NumberFailures
+		if r.Assignee == "" {
+			s.Unassigned++
+		}
+		if r.Needinfo != "" {
+			s.Needinfo++
+		}
+	}
+	for _, p := range permas {
+		s.Failures += p.NumberFailures
+		if p.Assignee == "" {
+			s.Unassigned++
+		}
+		if p.Needinfo != "" {
+			s.Needinfo++
+		}
+	}
+	return s
+}
+
+func writeHTMLReport(path string, results []Result, permas []PermaBug, taskTimeout *TaskTimeoutReport, below, resolved []Result) error {
+	data := htmlReportData(results, permas, taskTimeout, below, resolved)
+	return writeFile(path, func(w io.Writer) error { return renderHTML(w, htmlTemplate, data) })
+}
+
+func htmlReportData(results []Result, permas []PermaBug, taskTimeout *TaskTimeoutReport, below, resolved []Result) reportData {
+	// explicit bug lists have no threshold, so none is shown
+	shownThreshold := 0
+	if threshold >= 0 {
+		shownThreshold = max(threshold, 1)
+	}
+	data := reportData{
+		Intermittents:  groupByComponent(results, components),
+		BelowThreshold: groupByComponent(below, components),
+		Permas:         groupByComponent(permas, components),
+		TaskTimeout:    taskTimeout,
+		Generated:      time.Now().In(displayLoc).Format("2006-01-02 15:04 MST"),
+		DaysBack:       daysBack,
+		LogoURL:        logoURL,
+		AccentColor:    accentColor,
+		Platforms:      distinctPlatforms(results, permas),
+		TimeLimited:    timeLimited,
+		NeedinfoAging:  needinfoAging(results, permas),
+		Threshold:      shownThreshold,
+		Percentile:     thresholdPercentile,
+		Lang:           lang,
+		Resolved:       resolved,
+		Failed:         analysisFailures(),
+		Summary:        summarize(results, permas),
+		TruncatedFrom:  truncatedFrom,
+		HiddenNeedinfo: hiddenNeedinfo,
+		FailedSearches: failedSearches,
+		Stats:          failureStats,
+	}
+	if groupBy == "platform" {
+		data.Intermittents = groupByPlatform(results)
+		data.BelowThreshold = groupByPlatform(below)
+		data.Permas = groupByPlatform(permas)
+	} else {
+		setOwners(data.Intermittents)
+		setOwners(data.BelowThreshold)
+		setOwners(data.Permas)
+		data.Intermittents = rollUpSmallGroups(data.Intermittents, minBugsPerComponent)
+		data.Permas = rollUpSmallGroups(data.Permas, minBugsPerComponent)
+	}
+	return data
+}
+
+// formatExts maps each --format to the file extension of its output.
+var formatExts = map[string]string{"html": ".html", "gfm": ".md", "md": ".markdown", "json": ".json"}
+
+// outputPath returns where the given format is written. An explicit
+// --output is used as given for the first format; every other format gets
+// the path with its report extension swapped for the format's, or appended
+// when the path has none, so one flag names every file. Gzipped json also
+// gets .gz.
+func outputPath(output, format string, asGiven bool) string {
+	if asGiven {
+		return output
+	}
+	output = strings.TrimSuffix(output, ".gz")
+	ext := filepath.Ext(output)
+	if ext == ".htm" || slices.Contains(slices.Collect(maps.Values(formatExts)), ext) {
+		output = strings.TrimSuffix(output, ext)
+	}
+	output += formatExts[format]
+	if format == "json" && gzipJSON {
+		output += ".gz"
+	}
+	return output
+}
+
+// writeFile creates path and fills it with render; a path of "-" writes
+// to stdout instead.
+func writeFile(path string, render func(io.Writer) error) error {
+	if path == "-" {
+		return render(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := render(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func renderHTML(w io.Writer, tmpl string, data any) error {
+	t, err := parseTemplate(tmpl)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+func parseTemplate(tmpl string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"t":       func(msg string) string { return translate(lang, msg) },
+		"showBug": showBugURL,
+	}
+	return template.New("report").Funcs(funcs).Parse(tmpl)
+}
+
+// ===================== Markdown =====================
+
+// writeGFMReport writes the intermittents as a GitHub-flavored Markdown
+// table, which pastes into issues and PRs more compactly than the HTML lists.
+func writeGFMReport(path string, results []Result) error {
+	return writeFile(path, func(w io.Writer) error { return renderGFM(w, results) })
+}
+
+func renderGFM(w io.Writer, results []Result) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Intermittent Failures (%dd)\n\n", daysBack)
+	b.WriteString("| Bug | Summary | Failures | Platforms | Assignee | Needinfo |\n")
+	b.WriteString("| --- | --- | ---: | --- | --- | --- |\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "| [%d](%s) | %s | [%d](%s) | %s | %s | %s |\n",
+			r.ID, r.Link, gfmCell(r.Summary), r.NumberFailures, r.GraphLink,
+			gfmCell(strings.Join(platformStrings(r.Platforms), ", ")), gfmCell(r.Assignee), gfmCell(r.Needinfo))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownReport writes intermittents and permas as nested Markdown
+// lists mirroring the HTML report, for pasting into Bugzilla or a wiki.
+func writeMarkdownReport(path string, results []Result, permas []PermaBug) error {
+	return writeFile(path, func(w io.Writer) error { return renderMarkdown(w, results, permas) })
+}
+
+func renderMarkdown(w io.Writer, results []Result, permas []PermaBug) error {
+	var b strings.Builder
+	// nested items are indented four spaces: CommonMark (GitHub, Bugzilla)
+	// accepts it, and so do the older renderers that insist on four
+	sublist := func(label string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "    - %s:\n", label)
+		for _, item := range items {
+			fmt.Fprintf(&b, "        - %s\n", mdEscape(item))
+		}
+	}
+	fmt.Fprintf(&b, "## Intermittent Failures (%dd)\n\n", daysBack)
+	for _, r := range results {
+		fmt.Fprintf(&b, "- [Bug %d](%s) - %s: **%d** failures\n", r.ID, r.Link, mdEscape(r.Summary), r.NumberFailures)
+		sublist("Platforms", platformStrings(r.Platforms))
+		sublist("Repository breakdown", r.BreakdownList)
+	}
+	if len(permas) > 0 {
+		fmt.Fprintf(&b, "\n## Perma Failures (%dd)\n\n", daysBack)
+		for _, p := range permas {
+			fmt.Fprintf(&b, "- [Bug %d](%s) - %s: **%d** failures\n", p.ID, p.Link, mdEscape(p.Summary), p.NumberFailures)
+			sublist("Platforms", platformStrings(p.Platforms))
+			sublist("Repository breakdown", p.BreakdownList)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var mdEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "`", "\\`", "<", `\<`)
+
+// mdEscape keeps bug summaries from being read as Markdown formatting.
+func mdEscape(s string) string {
+	return mdEscaper.Replace(s)
+}
+
+// gfmCell escapes text for a Markdown table cell: pipes would end the cell
+// and newlines the row.
+func gfmCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// ===================== JSON =====================
+
+// jsonReport is the machine-readable report written by --format json. It
+// carries every field of the analyzed bugs, links included, so consumers
+// never have to rebuild Bugzilla or Treeherder URLs. Every key is
+// snake_case, nested ones included.
+type jsonReport struct {
+	Generated   time.Time          `json:"generated"`
+	DaysBack    int                `json:"days_back"`
+	Threshold   int                `json:"threshold"`
+	Results     []Result           `json:"results"`
+	Permas      []PermaBug         `json:"permas"`
+	TaskTimeout *TaskTimeoutReport `json:"task_timeout,omitempty"`
+	Failed      []AnalysisFailure  `json:"failed,omitempty"`
+}
+
+func writeJSONReport(path string, results []Result, permas []PermaBug, taskTimeout *TaskTimeoutReport) error {
+	report := jsonReport{
+		Generated:   time.Now().UTC(),
+		DaysBack:    daysBack,
+		Threshold:   threshold,
+		Results:     results,
+		Permas:      permas,
+		TaskTimeout: taskTimeout,
+		Failed:      analysisFailures(),
+	}
+	return writeFile(path, func(w io.Writer) error {
+		if !gzipJSON {
+			return renderJSON(w, report)
+		}
+		gz := gzip.NewWriter(w)
+		if err := renderJSON(gz, report); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+// Reports written before the fields were tagged used Go's CamelCase names;
+// these decoders accept both.
+
+func (r *Result) UnmarshalJSON(data []byte) error {
+	type plain Result // drops the method to avoid recursing
+	return json.Unmarshal(legacyKeys(data), (*plain)(r))
+}
+
+func (p *PermaBug) UnmarshalJSON(data []byte) error {
+	type plain PermaBug
+	return json.Unmarshal(legacyKeys(data), (*plain)(p))
+}
+
+func (t *TaskTimeoutReport) UnmarshalJSON(data []byte) error {
+	type plain TaskTimeoutReport
+	return json.Unmarshal(legacyKeys(data), (*plain)(t))
+}
+
+// legacyKeys rewrites an object's CamelCase keys to snake_case, leaving
+// anything else untouched. A snake_case key wins over its legacy spelling.
+func legacyKeys(data []byte) []byte {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return data
+	}
+	out := make(map[string]json.RawMessage, len(fields))
+	for k, v := range fields {
+		key := snakeCase(k)
+		if _, taken := out[key]; !taken || key == k {
+			out[key] = v
+		}
+	}
+	rewritten, err := json.Marshal(out)
+	if err != nil {
+		return data
+	}
+	return rewritten
+}
+
+// snakeCase converts a Go field name such as NumberFailures, QAContact or
+// AboveP90 to the snake_case key its json tag uses.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+func parseReport(r io.Reader) (jsonReport, error) {
+	var report jsonReport
+	err := json.NewDecoder(r).Decode(&report)
+	return report, err
+}
+
+// renderFromJSON renders a saved --format json report as HTML, restoring
+// the run settings the template shows, so the template can be tweaked
+// without querying Bugzilla or Treeherder again.
+func renderFromJSON(jsonPath, htmlPath string) error {
+	report, err := parseFile(jsonPath, parseReport)
+	if err != nil {
+		return err
+	}
+	daysBack, threshold = report.DaysBack, report.Threshold
+	for _, f := range report.Failed {
+		noteAnalysisError(f.ID, errors.New(f.Reason))
+	}
+	failureStats = annotateOutliers(report.Results)
+	return writeHTMLReport(htmlPath, report.Results, report.Permas, report.TaskTimeout, nil, nil)
+}
+
+// compareResults annotates results with their change since a previous
+// report, matched by bug ID, and returns the prior results that are no
+// longer reported.
+func compareResults(results, prior []Result) (resolved []Result) {
+	before := map[int]int{}
+	for _, p := range prior {
+		before[p.ID] = p.NumberFailures
+	}
+	for i := range results {
+		r := &results[i]
+		r.Compared = true
+		if n, ok := before[r.ID]; ok {
+			r.Delta = r.NumberFailures - n
+			delete(before, r.ID)
+		} else {
+			r.New = true
+		}
+	}
+	for _, p := range prior {
+		if _, ok := before[p.ID]; ok {
+			resolved = append(resolved, p)
+		}
+	}
+	return resolved
+}
+
+func renderJSON(w io.Writer, report jsonReport) error {
+	enc := json.NewEncoder(w)
+	if prettyJSON {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(report)
+}
+
+// ===================== Translations =====================
+
+// messages holds the report's fixed UI labels per locale, keyed by the
+// English text. English needs no entry; missing translations fall back to it.
+var messages = map[string]map[string]string{
+	"de": {
+		"3–7 days":                          "3–7 Tage",
+		"Above p90":                         "Über p90",
+		"Assigned To":                       "Zugewiesen an",
+		"Below threshold":                   "Unter dem Schwellenwert",
+		"Comments":                          "Kommentare",
+		"Could not analyze":                 "Analyse fehlgeschlagen",
+		"Failures per bug":                  "Fehler pro Bug",
+		"File an issue on GitHub":           "Problem auf GitHub melden",
+		"Generic Task Timeout":              "Allgemeines Task-Timeout",
+		"Intermittent Failures":             "Sporadische Fehler",
+		"Intermittent bugs":                 "Sporadische Bugs",
+		"Last seen":                         "Zuletzt gesehen",
+		"Last updated":                      "Zuletzt aktualisiert",
+		"New":                               "Neu",
+		"No longer reported":                "Nicht mehr gemeldet",
+		"Open needinfos":                    "Offene Needinfos",
+		"Opened":                            "Eröffnet",
+		"Orange Factor Graph":               "Orange-Factor-Diagramm",
+		"Pending needinfos":                 "Offene Needinfos",
+		"Perma Failures":                    "Permanente Fehler",
+		"Perma bugs":                        "Permanente Bugs",
+		"Platforms":                         "Plattformen",
+		"Platforms affected":                "Betroffene Plattformen",
+		"Priority":                          "Priorität",
+		"QA Contact":                        "QA-Kontakt",
+		"Reopened":                          "Wiedereröffnet",
+		"Repository Breakdown":              "Aufschlüsselung nach Repository",
+		"Runbook":                           "Runbook",
+		"Search failed":                     "Suche fehlgeschlagen",
+		"Stalled":                           "Ins Stocken geraten",
+		"Suite Breakdown":                   "Aufschlüsselung nach Suite",
+		"Threshold":                         "Schwellenwert",
+		"Time-limited run":                  "Zeitlich begrenzter Lauf",
+		"Total failures":                    "Fehler insgesamt",
+		"Triage owner":                      "Triage-Verantwortliche(r)",
+		"Unassigned":                        "Nicht zugewiesen",
+		"Whiteboard":                        "Whiteboard",
+		"ago":                               "her",
+		"and":                               "und",
+		"between":                           "zwischen",
+		"bugs with an open needinfo hidden": "Bugs mit offenem Needinfo ausgeblendet",
+		"could not be fetched, so they are missing from this report.": "konnten nicht abgerufen werden und fehlen daher in diesem Bericht.",
+		"failures":               "Fehler",
+		"median":                 "Median",
+		"out of":                 "von",
+		"over a week":            "über eine Woche",
+		"per day":                "pro Tag",
+		"percentile of this run": "Perzentil dieses Laufs",
+		"rate":                   "Rate",
+		"requested by":           "angefragt von",
+		"runs":                   "Läufen",
+		"showing top":            "es werden die ersten",
+		"since the last report":  "seit dem letzten Bericht",
+		"the maximum runtime was reached, so this report is partial.": "die maximale Laufzeit wurde erreicht, daher ist dieser Bericht unvollständig.",
+		"under 3 days":   "unter 3 Tagen",
+		"vs baseline of": "gegenüber dem Richtwert von",
+		"window":         "Zeitraum",
+	},
+}
+
+// translate returns msg in the given locale, or msg itself when there is no
+// translation.
+func translate(locale, msg string) string {
+	if t, ok := messages[locale][msg]; ok {
+		return t
 	}
-	return aggregateBreakdown(failures)
+	return msg
 }
 
-func fetchFailureRate(bugID int, start, end string) string {
-	u := fmt.Sprintf("%s/failurecount/?startday=%s&endday=%s&tree=all&bug=%d", treeherderBase, start, end, bugID)
-	resp, err := get(u)
+// ===================== Slack =====================
+
+// slackMessage summarizes the top n intermittents, in report order, as Slack
+// mrkdwn text.
+func slackMessage(results []Result, n int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*PerfTest triage:* %d intermittents with %d+ failures in the last %d days", len(results), max(threshold, 1), daysBack)
+	for i, r := range results {
+		if i == n {
+			fmt.Fprintf(&b, "\n…and %d more", len(results)-n)
+			break
+		}
+		// & < and > are the only characters Slack needs escaped
+		summary := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(r.Summary)
+		fmt.Fprintf(&b, "\n• <%s|Bug %d> %s — *%d* failures", r.Link, r.ID, summary, r.NumberFailures)
+	}
+	return b.String()
+}
+
+// postSlack sends the summary to a Slack incoming webhook.
+func postSlack(webhook string, results []Result, n int) error {
+	body, err := json.Marshal(map[string]string{"text": slackMessage(results, n)})
 	if err != nil {
-		return ""
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
+			slog.Warn("error closing body", "err", err)
 		}
 	}()
-
-	var days []THDailyCount
-	if err := json.NewDecoder(resp.Body).Decode(&days); err != nil {
-		return ""
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
 	}
+	return nil
+}
 
-	var totalRuns, totalFailures int
-	for _, d := range days {
-		totalRuns += d.TestRuns
-		totalFailures += d.FailureCount
+// ===================== GitHub =====================
+
+// githubAPI is the GitHub REST API root; tests point it at a stub server.
+var githubAPI = "https://api.github.com"
+
+// notifyGitHub posts the intermittents table to a GitHub issue. A run with
+// nothing to report posts nothing unless force is set, so a quiet week
+// doesn't add an empty comment to the triage issue.
+func notifyGitHub(repo string, issue int, token string, results []Result, force bool) {
+	if len(results) == 0 && !force {
+		slog.Info("not commenting on the GitHub issue: no intermittents to report", "repo", repo, "issue", issue)
+		return
 	}
-	if totalRuns == 0 {
-		return ""
+	if err := postGitHubComment(repo, issue, token, results); err != nil {
+		slog.Warn("GitHub comment failed", "repo", repo, "issue", issue, "err", err)
+		return
 	}
-	return fmt.Sprintf("%.1f%%", float64(totalFailures)/float64(totalRuns)*100)
+	fmt.Println("✅ GitHub issue commented")
 }
 
-func aggregateBreakdown(failures []THJobFailure) (breakdowns []string, platforms []string) {
-	treeCounts := map[string]int{}
-	platformCounts := map[string]int{}
-	for _, f := range failures {
-		treeCounts[f.Tree]++
-		platformStr := f.Platform
-		if strings.EqualFold(platformStr, "toolchains") {
-			platformStr = f.TestSuite
-		}
-		if p := normalizePlatform(platformStr); p != "" {
-			platformCounts[p]++
-		}
+// postGitHubComment adds the renderGFM table as a comment on issue in repo
+// (owner/name). Auth and rate-limit refusals are turned into errors that say
+// what to fix rather than a bare status.
+func postGitHubComment(repo string, issue int, token string, results []Result) error {
+	var md bytes.Buffer
+	if err := renderGFM(&md, results); err != nil {
+		return err
 	}
-
-	for tree, count := range treeCounts {
-		breakdowns = append(breakdowns, fmt.Sprintf("%s: %d", tree, count))
+	body, err := json.Marshal(map[string]string{"body": md.String()})
+	if err != nil {
+		return err
 	}
-	sort.Strings(breakdowns)
-
-	for p, count := range platformCounts {
-		platforms = append(platforms, fmt.Sprintf("%s: %d", p, count))
+	u := fmt.Sprintf("%s/repos/%s/issues/%d/comments", githubAPI, repo, issue)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
-	sort.Strings(platforms)
-	return
-}
-
-func normalizePlatform(platform string) string {
-	p := strings.ToLower(platform)
-	if p == "" {
-		return ""
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
 	}
-	base := strings.SplitN(p, "-", 2)[0]
-	switch {
-	case strings.HasPrefix(base, "android"):
-		parts := strings.Split(p, "-")
-		if len(parts) >= 3 {
-			return strings.Join(parts[:3], "-") // e.g. android-hw-p6, android-hw-a55
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
 		}
-		return "android"
-	case strings.HasPrefix(base, "linux"):
-		return base // e.g. linux1804, linux2404
-	case strings.HasPrefix(base, "macosx"), strings.HasPrefix(base, "osx"):
-		return base // e.g. macosx1470, macosx1500
-	case strings.HasPrefix(base, "win"):
-		return base // e.g. windows11
-	}
-	// Fallback for strings like "toolchain-linux64-custom-car"
+	}()
 	switch {
-	case strings.Contains(p, "android"):
-		return "android"
-	case strings.Contains(p, "linux"):
-		return "linux"
-	case strings.Contains(p, "macos") || strings.Contains(p, "osx"):
-		return "macos"
-	case strings.Contains(p, "win"):
-		return "windows"
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return fmt.Errorf("GitHub rate limit reached (%s); retry after %s", resp.Status, githubRetryAfter(resp.Header))
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("GitHub rejected the token (%s); check --github-token or $GITHUB_TOKEN", resp.Status)
+	case resp.StatusCode == http.StatusForbidden, resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("GitHub returned %s; the token may lack permission to comment on %s#%d", resp.Status, repo, issue)
+	default:
+		return fmt.Errorf("GitHub returned %s", resp.Status)
 	}
-	return platform
 }
 
-// ===================== Analyzer =====================
-
-func analyzeAll(bugs []Bug, start, end string, counts, prevCounts map[int]int, twoDayStart string, twoDayCounts map[int]int) []Result {
-	if len(bugs) == 0 {
-		return nil
+// githubRetryAfter says when a rate-limited request may be retried, from
+// Retry-After (secondary limits) or X-RateLimit-Reset (primary limits).
+func githubRetryAfter(h http.Header) string {
+	if secs, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+		return (time.Duration(secs) * time.Second).String()
 	}
-
-	var qualifying []Bug
-	for _, b := range bugs {
-		if counts[b.ID] >= threshold {
-			qualifying = append(qualifying, b)
-		}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		return time.Unix(reset, 0).UTC().Format(time.RFC3339)
 	}
+	return "a while"
+}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var results []Result
-	sema := make(chan struct{}, maxConcurrent)
-
-	for _, bug := range qualifying {
-		wg.Add(1)
-		sema <- struct{}{}
-
-		go func(b Bug) {
-			defer wg.Done()
-			defer func() { <-sema }()
-
-			breakdowns, platforms := fetchTreeherderBreakdown(b.ID, start, end)
-			rate := fetchFailureRate(b.ID, start, end)
-
-			twoDayCount := twoDayCounts[b.ID]
-			var twoDayRate string
-			var twoDayBreakdowns, twoDayPlatforms []string
-			if twoDayCount > 0 {
-				twoDayRate = fetchFailureRate(b.ID, twoDayStart, end)
-				twoDayBreakdowns, twoDayPlatforms = fetchTreeherderBreakdown(b.ID, twoDayStart, end)
-			}
-
-			ni := ""
-			for _, flag := range b.Flags {
-				if flag.Name == "needinfo" && flag.Requestee != "" {
-					ni = flag.Requestee
-					break
-				}
-			}
-
-			assigned := b.AssignedTo
-			if assigned == "nobody@mozilla.org" || assigned == "" {
-				assigned = ""
-			}
-
-			graphLink := fmt.Sprintf(
-				"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
-				start, end, b.ID,
-			)
-
-			mu.Lock()
-			results = append(results, Result{
-				ID:              b.ID,
-				Link:            fmt.Sprintf("https://bugzilla.mozilla.org/show_bug.cgi?id=%d", b.ID),
-				NumberFailures:  counts[b.ID],
-				Summary:         b.Summary,
-				Component:       b.Component,
-				Age:             bugAge(b.CreationTime),
-				Rate:            rate,
-				Trend:           computeTrend(counts[b.ID], prevCounts[b.ID]),
-				TwoDay:          twoDayCount,
-				TwoDayRate:      twoDayRate,
-				TwoDayPlatforms: twoDayPlatforms,
-				TwoDayBreakdown: twoDayBreakdowns,
-				Platforms:       platforms,
-				BreakdownList:   breakdowns,
-				Needinfo:        ni,
-				GraphLink:       graphLink,
-				Assignee:        assigned,
-			})
-			mu.Unlock()
-		}(bug)
-	}
-	wg.Wait()
+// ===================== Auto comment =====================
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].NumberFailures > results[j].NumberFailures
+// autoCommentCandidates returns the reported intermittents over the
+// threshold that nobody owns yet: no assignee and no pending needinfo.
+func autoCommentCandidates(results []Result) []Result {
+	return filterBugs(results, func(r Result) bool {
+		return r.NumberFailures >= max(threshold, 1) && r.Assignee == "" && r.Needinfo == ""
 	})
-	return results
 }
 
-// ===================== Task Timeout =====================
+// triageCommentMarker ends every triage comment, so later runs can tell
+// which bugs already have one.
+const triageCommentMarker = "(Posted by the PerfTest triage report.)"
 
-func filterPerfFailures(failures []THJobFailure) []THJobFailure {
-	var perf []THJobFailure
-	for _, f := range failures {
-		suite := strings.ToLower(f.TestSuite)
-		for _, kw := range perfTestKeywords {
-			if strings.Contains(suite, kw) {
-				perf = append(perf, f)
-				break
-			}
+// triageComment is the standard comment left on an unowned intermittent.
+func triageComment(r Result) string {
+	return fmt.Sprintf("This intermittent failed %d times between %s and %s and has no assignee or pending needinfo. "+
+		"Could someone who owns %s take a look?\n\n%s",
+		r.NumberFailures, r.WindowStart, r.WindowEnd, r.Component, triageCommentMarker)
+}
+
+// autoCommentBugs prints the comment for each candidate, and posts it when
+// confirm is set. Bugs an earlier run already commented on are skipped, so a
+// scheduled job doesn't repeat itself. A failed post is logged and the rest
+// still go out.
+func autoCommentBugs(results []Result, confirm bool) {
+	for _, r := range autoCommentCandidates(results) {
+		commented, err := hasTriageComment(r.ID)
+		if err != nil {
+			slog.Warn("checking for an earlier triage comment failed, not commenting", "bug", r.ID, "err", err)
+			continue
+		}
+		if commented {
+			slog.Debug("skipping auto-comment", "bug", r.ID, "reason", "already has a triage comment")
+			continue
+		}
+		text := triageComment(r)
+		if !confirm {
+			fmt.Printf("Would comment on bug %d:\n%s\n\n", r.ID, text)
+			continue
+		}
+		if err := postBugComment(r.ID, text); err != nil {
+			slog.Warn("posting the triage comment failed", "bug", r.ID, "err", err)
+			continue
 		}
+		fmt.Printf("✅ Commented on bug %d\n", r.ID)
 	}
-	return perf
 }
 
-func treeBreakdownFrom(failures []THJobFailure) []string {
-	counts := map[string]int{}
-	for _, f := range failures {
-		counts[f.Tree]++
-	}
-	var out []string
-	for tree, count := range counts {
-		out = append(out, fmt.Sprintf("%s: %d", tree, count))
-	}
-	sort.Strings(out)
-	return out
+type CommentResponse struct {
+	BugzillaError
+	Bugs map[string]struct {
+		Comments []struct {
+			Text string `json:"text"`
+		} `json:"comments"`
+	} `json:"bugs"`
 }
 
-func platformBreakdownFrom(failures []THJobFailure) []string {
-	counts := map[string]int{}
-	for _, f := range failures {
-		if p := normalizePlatform(f.Platform); p != "" {
-			counts[p]++
+// hasTriageComment reports whether any of the bug's comments carries
+// triageCommentMarker.
+func hasTriageComment(bugID int) (bool, error) {
+	params := url.Values{}
+	params.Set("include_fields", "text")
+	resp, err := get(fmt.Sprintf("%s/%d/comment?%s", bugzillaBase, bugID, params.Encode()))
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
 		}
+	}()
+
+	var out CommentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, fmt.Errorf("decode comments: %w", err)
 	}
-	var out []string
-	for p, count := range counts {
-		out = append(out, fmt.Sprintf("%s: %d", p, count))
+	if err := out.err(); err != nil {
+		return false, err
 	}
-	sort.Strings(out)
-	return out
+	for _, c := range out.Bugs[strconv.Itoa(bugID)].Comments {
+		if strings.Contains(c.Text, triageCommentMarker) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
-func suiteBreakdownFrom(perf []THJobFailure) []string {
-	counts := map[string]int{}
-	for _, f := range perf {
-		counts[f.TestSuite]++
+// postBugComment adds a comment to a bug through the Bugzilla REST API.
+func postBugComment(bugID int, text string) error {
+	body, err := json.Marshal(map[string]string{"comment": text})
+	if err != nil {
+		return err
 	}
-	var out []string
-	for suite, count := range counts {
-		out = append(out, fmt.Sprintf("%s: %d", suite, count))
+	u := fmt.Sprintf("%s/%d/comment", bugzillaBase, bugID)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
 	}
-	sort.Strings(out)
-	return out
-}
-
-func fetchRawBreakdown(bugID int, start, end string) []THJobFailure {
-	u := fmt.Sprintf("%s/failuresbybug/?startday=%s&endday=%s&tree=all&bug=%d", treeherderBase, start, end, bugID)
-	resp, err := get(u)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-BUGZILLA-API-KEY", bugzillaAPIKey)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		log.Printf("fetch breakdown bug %d: %v", bugID, err)
-		return nil
+		return err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("warning: error closing body: %v", err)
+			slog.Warn("error closing body", "err", err)
 		}
 	}()
-	var failures []THJobFailure
-	if err := json.NewDecoder(resp.Body).Decode(&failures); err != nil {
-		log.Printf("decode breakdown bug %d: %v", bugID, err)
-		return nil
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("comment returned %s", resp.Status)
 	}
-	return failures
+	return nil
 }
 
-func analyzeTaskTimeout(start, end, twoDayStart string) *TaskTimeoutReport {
-	perf := filterPerfFailures(fetchRawBreakdown(taskTimeoutBugID, start, end))
-	if len(perf) < threshold {
-		return nil
-	}
-	twoDayPerf := filterPerfFailures(fetchRawBreakdown(taskTimeoutBugID, twoDayStart, end))
+// ===================== Email =====================
 
-	return &TaskTimeoutReport{
-		Link: fmt.Sprintf("https://bugzilla.mozilla.org/show_bug.cgi?id=%d", taskTimeoutBugID),
-		GraphLink: fmt.Sprintf(
-			"https://treeherder.mozilla.org/intermittent-failures/bugdetails?startday=%s&endday=%s&tree=all&bug=%d",
-			start, end, taskTimeoutBugID,
-		),
-		PerfFailures:         len(perf),
-		SuiteBreakdown:       suiteBreakdownFrom(perf),
-		TreeBreakdown:        treeBreakdownFrom(perf),
-		Platforms:            platformBreakdownFrom(perf),
-		TwoDayPerfFailures:   len(twoDayPerf),
-		TwoDaySuiteBreakdown: suiteBreakdownFrom(twoDayPerf),
-		TwoDayTreeBreakdown:  treeBreakdownFrom(twoDayPerf),
-		TwoDayPlatforms:      platformBreakdownFrom(twoDayPerf),
+// emailReport sends the already-rendered HTML report at path as the body of
+// an email. It authenticates only when $SMTP_PASSWORD is set, so relays that
+// accept unauthenticated mail from the CI network work too.
+func emailReport(host string, port int, user, from string, to []string, path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if pass := os.Getenv("SMTP_PASSWORD"); pass != "" {
+		auth = smtp.PlainAuth("", user, pass, host)
 	}
+	subject := "PerfTest triage report " + time.Now().In(displayLoc).Format("2006-01-02")
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	return smtp.SendMail(addr, auth, from, to, emailMessage(from, to, subject, body))
 }
 
-// ===================== HTML =====================
-
-type reportData struct {
-	Intermittents []ComponentGroup[Result]
-	Permas        []ComponentGroup[PermaBug]
-	TaskTimeout   *TaskTimeoutReport
-	Generated     string
-	DaysBack      int
+// emailMessage builds an RFC 5322 message with an HTML body.
+func emailMessage(from string, to []string, subject string, html []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.Write(html)
+	return b.Bytes()
 }
 
-func writeHTMLReport(results []Result, permas []PermaBug, taskTimeout *TaskTimeoutReport) {
-	tmpl := reportTemplate
+// ===================== Upload =====================
 
-	data := reportData{
-		Intermittents: groupByComponent(results, components),
-		Permas:        groupByComponent(permas, components),
-		TaskTimeout:   taskTimeout,
-		Generated:     time.Now().UTC().Format("2006-01-02 15:04 MST"),
-		DaysBack:      daysBack,
+// uploadReport PUTs the report file at path to dest, which is expected to be a
+// presigned S3 or GCS https URL. Bare s3:// and gs:// destinations would need
+// the cloud SDKs and credentials, so they are rejected with a hint instead.
+func uploadReport(path, dest string) error {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https", "http":
+	case "s3", "gs":
+		return fmt.Errorf("%s:// URLs are not supported; pass a presigned https URL instead", u.Scheme)
+	default:
+		return fmt.Errorf("unsupported upload URL scheme %q", u.Scheme)
 	}
 
-	f, err := os.Create(outputHTML)
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPut, dest, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(path))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		log.Fatalf("create file: %v", err)
+		return err
 	}
 	defer func() {
-		if err := f.Close(); err != nil {
-			log.Printf("warning: error closing file: %v", err)
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("error closing body", "err", err)
+		}
+	}()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("upload returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ===================== Serve =====================
+
+// servedReport is the page --serve answers with and how its latest
+// regeneration went.
+type servedReport struct {
+	page      []byte
+	generated time.Time // when page was generated
+	lastErr   error     // why the latest regeneration failed, nil if it didn't
+}
+
+// serveReport serves the latest generated report at / on addr, and its
+// status at /healthz. generate runs once at startup and then every
+// interval; a failed regeneration keeps the previous report up.
+func serveReport(addr string, interval, maxAge time.Duration, generate func() ([]byte, error)) error {
+	var current atomic.Pointer[servedReport]
+	go func() {
+		for {
+			regenerate(&current, generate)
+			time.Sleep(interval)
 		}
 	}()
+	fmt.Println("Serving the report on", addr)
+	srv := &http.Server{Addr: addr, Handler: reportHandler(&current, maxAge), ReadHeaderTimeout: 10 * time.Second}
+	return srv.ListenAndServe()
+}
 
-	if err := renderHTML(f, tmpl, data); err != nil {
-		log.Fatalf("template exec: %v", err)
+// regenerate stores a freshly generated report in current, leaving the
+// previous one in place when generation fails.
+func regenerate(current *atomic.Pointer[servedReport], generate func() ([]byte, error)) {
+	page, err := generate()
+	if err != nil {
+		slog.Warn("regenerating the report failed, serving the previous one", "err", err)
+		next := servedReport{lastErr: err}
+		if prev := current.Load(); prev != nil {
+			next.page, next.generated = prev.page, prev.generated
+		}
+		current.Store(&next)
+		return
 	}
+	current.Store(&servedReport{page: page, generated: time.Now()})
+	fmt.Println("✅ Report regenerated")
 }
 
-func renderHTML(w io.Writer, tmpl string, data any) error {
-	t := template.Must(template.New("report").Parse(tmpl))
-	return t.Execute(w, data)
+// reportHandler answers / with 503 until the first report is ready, so a
+// bookmarked dashboard only needs a reload after a restart. /healthz is 200
+// only while the latest regeneration succeeded less than maxAge ago, so
+// monitoring can alert on a stale dashboard.
+func reportHandler(current *atomic.Pointer[servedReport], maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served := current.Load()
+		switch r.URL.Path {
+		case "/":
+			if served == nil || served.page == nil {
+				http.Error(w, "the report is still being generated, try again in a few minutes", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write(served.page)
+		case "/healthz":
+			var status struct {
+				OK        bool      `json:"ok"`
+				Generated time.Time `json:"generated,omitzero"`
+				LastError string    `json:"last_error,omitempty"`
+			}
+			if served != nil {
+				status.Generated = served.generated
+				if served.lastErr != nil {
+					status.LastError = served.lastErr.Error()
+				}
+				status.OK = served.lastErr == nil && time.Since(served.generated) <= maxAge
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if !status.OK {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			_ = json.NewEncoder(w).Encode(status)
+		default:
+			http.NotFound(w, r)
+		}
+	})
 }
 
 // ===================== Open in browser =====================
 
-func openInBrowser(file string) {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
+// openInBrowser opens the report with the OS default handler. With reuseTab
+// on macOS the browser is left in the background (open -g) so repeated runs
+// don't keep stealing focus; other platforms have no portable way to target
+// an existing tab, so the flag is ignored there.
+func openInBrowser(file string, reuseTab bool, openWith string) {
+	cmd := browserCommand(file, reuseTab, openWith, runtime.GOOS)
+	if cmd == nil {
+		fmt.Printf("Open %s manually in your browser.\n", file)
+		return
+	}
+	if err := cmd.Start(); err != nil && openWith != "" {
+		slog.Warn("--open-with failed", "command", openWith, "err", err)
+	}
+}
+
+// browserCommand returns the command that opens file: --open-with, split on
+// spaces so it can carry arguments such as "firefox --new-tab", or else the
+// OS default opener. It returns nil when the OS has no known opener.
+func browserCommand(file string, reuseTab bool, openWith, goos string) *exec.Cmd {
+	if args := strings.Fields(openWith); len(args) > 0 {
+		return exec.Command(args[0], append(args[1:], file)...)
+	}
+	switch goos {
 	case "darwin":
-		cmd = exec.Command("open", file)
+		if reuseTab {
+			return exec.Command("open", "-g", file)
+		}
+		return exec.Command("open", file)
 	case "linux":
-		cmd = exec.Command("xdg-open", file)
+		return exec.Command("xdg-open", file)
 	case "windows":
-		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", file)
-	default:
-		fmt.Printf("Open %s manually in your browser.\n", file)
-		return
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", file)
 	}
-	_ = cmd.Start()
+	return nil
 }
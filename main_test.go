@@ -2,11 +2,27 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -101,8 +117,18 @@ func TestNormalizePlatform(t *testing.T) {
 		// Windows platforms used in Talos and mozperftest
 		{"windows11-64-2009-shippable", "windows11"},
 		{"windows10-64-2009-shippable", "windows10"},
+		// Surrounding and internal whitespace doesn't create new platforms
+		{" Linux1804-64-shippable-qr ", "linux1804"},
+		{"windows11 64-2009", "windows11"},
+		// Other platformFamilies keywords, and a family anywhere in the name
+		{"ubuntu2204-64", "ubuntu2204"},
+		{"a51-11-0-aarch64-shippable", "a51"},
+		{"toolchain-osx-cross", "macosx"},
+		{"toolchain-win64-clang", "windows"},
 		// Unknown platforms returned as-is
 		{"unknown-platform", "unknown-platform"},
+		{" Gecko-Thing ", "gecko-thing"},
+		{"Gecko  Thing", "gecko-thing"},
 		{"toolchains", "toolchains"},
 		{"", ""},
 	}
@@ -133,10 +159,10 @@ func TestFetchFailureRate(t *testing.T) {
 	treeherderBase = server.URL
 	defer func() { treeherderBase = old }()
 
-	rate := fetchFailureRate(1234, "2026-03-14", "2026-03-21")
+	rate, runs := fetchFailureRate(1234, "2026-03-14", "2026-03-21")
 	// 50 failures / 400 runs = 12.5%
-	if rate != "12.5%" {
-		t.Errorf("got %q, want %q", rate, "12.5%")
+	if rate != "12.5%" || runs != 400 {
+		t.Errorf("got %q over %d runs, want %q over 400", rate, runs, "12.5%")
 	}
 }
 
@@ -154,7 +180,7 @@ func TestFetchFailureRateZeroRuns(t *testing.T) {
 	treeherderBase = server.URL
 	defer func() { treeherderBase = old }()
 
-	rate := fetchFailureRate(1234, "2026-03-14", "2026-03-21")
+	rate, _ := fetchFailureRate(1234, "2026-03-14", "2026-03-21")
 	if rate != "" {
 		t.Errorf("expected empty string for zero runs, got %q", rate)
 	}
@@ -169,7 +195,7 @@ func TestAggregateBreakdown(t *testing.T) {
 		{Platform: "toolchains", Tree: "mozilla-central", TestSuite: "toolchain-linux64-custom-car"},
 	}
 
-	breakdowns, platforms := aggregateBreakdown(failures)
+	breakdowns, platforms, _ := aggregateBreakdown(failures)
 
 	expectedBreakdowns := []string{"autoland: 3", "mozilla-central: 2"}
 	if len(breakdowns) != len(expectedBreakdowns) {
@@ -185,7 +211,7 @@ func TestAggregateBreakdown(t *testing.T) {
 	for _, want := range []string{"linux1804: 2", "macosx1470: 1", "windows11: 1", "linux: 1"} {
 		found := false
 		for _, got := range platforms {
-			if got == want {
+			if got.String() == want {
 				found = true
 				break
 			}
@@ -215,7 +241,10 @@ func TestFetchTreeherderCounts(t *testing.T) {
 	treeherderBase = server.URL
 	defer func() { treeherderBase = old }()
 
-	counts := fetchTreeherderCounts("2026-03-12", "2026-03-19")
+	counts, err := fetchTreeherderCounts("2026-03-12", "2026-03-19")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if counts[1234] != 142 {
 		t.Errorf("bug 1234: got %d, want 142", counts[1234])
@@ -230,10 +259,10 @@ func TestFetchTreeherderCounts(t *testing.T) {
 
 func TestFetchTreeherderBreakdown(t *testing.T) {
 	payload := []THJobFailure{
-		{Platform: "linux1804-64-shippable-qr", Tree: "autoland", TestSuite: "raptor-tp6"},
-		{Platform: "linux1804-64-shippable-qr", Tree: "autoland", TestSuite: "raptor-tp6"},
+		{Platform: "linux1804-64-shippable-qr", Tree: "autoland", TestSuite: "raptor-tp6", PushTime: "2026-03-14 08:00:00"},
+		{Platform: "linux1804-64-shippable-qr", Tree: "autoland", TestSuite: "raptor-tp6", PushTime: "2026-03-18 21:30:00"},
 		{Platform: "android-hw-p6-13-0-arm64-shippable", Tree: "autoland", TestSuite: "raptor-speedometer"},
-		{Platform: "windows11-64-2009-shippable", Tree: "mozilla-central", TestSuite: "talos-g5"},
+		{Platform: "windows11-64-2009-shippable", Tree: "mozilla-central", TestSuite: "talos-g5", PushTime: "2026-03-16 12:00:00"},
 	}
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -247,7 +276,14 @@ func TestFetchTreeherderBreakdown(t *testing.T) {
 	treeherderBase = server.URL
 	defer func() { treeherderBase = old }()
 
-	breakdowns, platforms := fetchTreeherderBreakdown(1234, "2026-03-12", "2026-03-19")
+	breakdowns, platforms, _, first, last := fetchTreeherderBreakdown(1234, "2026-03-12", "2026-03-19")
+
+	if want := time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC); !first.Equal(want) {
+		t.Errorf("first failure: got %v, want %v", first, want)
+	}
+	if want := time.Date(2026, 3, 18, 21, 30, 0, 0, time.UTC); !last.Equal(want) {
+		t.Errorf("last failure: got %v, want %v", last, want)
+	}
 
 	if len(breakdowns) != 2 {
 		t.Fatalf("breakdowns: got %v, want 2 entries", breakdowns)
@@ -262,7 +298,7 @@ func TestFetchTreeherderBreakdown(t *testing.T) {
 	for _, want := range []string{"android-hw-p6: 1", "linux1804: 2", "windows11: 1"} {
 		found := false
 		for _, got := range platforms {
-			if got == want {
+			if got.String() == want {
 				found = true
 				break
 			}
@@ -291,7 +327,10 @@ func TestFetchIntermittentBugs(t *testing.T) {
 	bugzillaBase = server.URL
 	defer func() { bugzillaBase = old }()
 
-	bugs := fetchIntermittentBugs()
+	bugs, err := fetchIntermittentBugs()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(bugs) != 2 {
 		t.Fatalf("got %d bugs, want 2 (perma should be filtered)", len(bugs))
@@ -346,20 +385,95 @@ func TestAnalyzeAllFiltersAndSorts(t *testing.T) {
 	if results[1].Trend != "↑ +20" {
 		t.Errorf("bug 100 trend: got %q, want %q", results[1].Trend, "↑ +20")
 	}
+	if results[0].WindowStart != "2026-03-12" || results[0].WindowEnd != "2026-03-19" {
+		t.Errorf("window: got %s to %s, want 2026-03-12 to 2026-03-19", results[0].WindowStart, results[0].WindowEnd)
+	}
+}
+
+func TestResultLess(t *testing.T) {
+	oldKey := sortKey
+	defer func() { sortKey = oldKey }()
+
+	results := []Result{
+		{ID: 3, NumberFailures: 20, FailuresPerDay: 10, Summary: "b", Assignee: ""},
+		{ID: 1, NumberFailures: 50, FailuresPerDay: 50.0 / 7, Summary: "c", Assignee: "zed@mozilla.com"},
+		{ID: 2, NumberFailures: 30, FailuresPerDay: 30.0 / 7, Summary: "a", Assignee: "amy@mozilla.com"},
+	}
+	tests := []struct {
+		key  string
+		want []int
+	}{
+		{"failures", []int{1, 2, 3}},
+		{"per-day", []int{3, 1, 2}},
+		{"id", []int{1, 2, 3}},
+		{"assignee", []int{2, 1, 3}},
+		{"summary", []int{2, 3, 1}},
+	}
+	for _, tt := range tests {
+		sortKey = tt.key
+		sorted := slices.Clone(results)
+		sort.Slice(sorted, func(i, j int) bool { return resultLess(sorted[i], sorted[j]) })
+		var got []int
+		for _, r := range sorted {
+			got = append(got, r.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("--sort %s: got %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFailuresPerDay(t *testing.T) {
+	tests := []struct {
+		name  string
+		first time.Time
+		want  float64
+	}{
+		{"unknown first failure spreads over the window", time.Time{}, 3},
+		{"started two days ago", time.Date(2026, 3, 17, 9, 0, 0, 0, time.UTC), 10.5},
+		{"started today counts as one day", time.Date(2026, 3, 19, 6, 0, 0, 0, time.UTC), 21},
+	}
+	for _, tt := range tests {
+		if got := failuresPerDay(21, "2026-03-12", "2026-03-19", tt.first); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{20 * time.Minute, "20 minutes"},
+		{5 * time.Hour, "5 hours"},
+		{72 * time.Hour, "3 days"},
+	}
+	for _, tt := range tests {
+		r := Result{LastFailure: time.Now().Add(-tt.ago - time.Second)}
+		if got := r.LastSeen(); got != tt.want {
+			t.Errorf("LastSeen(%v ago) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+	if got := (Result{}).LastSeen(); got != "" {
+		t.Errorf("unknown last failure: got %q, want empty", got)
+	}
 }
 
 func TestRenderHTML(t *testing.T) {
 	results := []Result{
 		{ID: 1234, Summary: "Intermittent raptor timeout", Component: "Raptor", NumberFailures: 42,
 			Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=1234", GraphLink: "https://treeherder.mozilla.org/",
-			Platforms: []string{"linux1804: 3"}, BreakdownList: []string{"autoland: 3"}},
+			Platforms: []PlatformCount{{"linux1804", 3}}, BreakdownList: []string{"autoland: 3"}},
 	}
 	permas := []PermaBug{
 		{ID: 5678, Summary: "Perma talos failure", Component: "Talos",
 			Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=5678", GraphLink: "https://treeherder.mozilla.org/"},
 	}
 
-	writeHTMLReport(results, permas, nil)
+	if err := writeHTMLReport(outputHTML, results, permas, nil, nil, nil); err != nil {
+		t.Fatalf("writeHTMLReport failed: %v", err)
+	}
 
 	// Use renderHTML directly with a buffer to verify output
 	var buf bytes.Buffer
@@ -392,12 +506,15 @@ func TestFetchPermaBugs(t *testing.T) {
 	payload := BugListResponse{Bugs: []Bug{
 		{ID: 10, Summary: "Perma raptor-browsertime timeout", Component: "Raptor",
 			AssignedTo: "dev@mozilla.com",
-			Flags: []struct {
-				Name      string `json:"name"`
-				Requestee string `json:"requestee"`
-			}{{Name: "needinfo", Requestee: "manager@mozilla.com"}}},
+			QAContact:  "qa@mozilla.com",
+			Priority:   "P2",
+			Whiteboard: "[perftest:triage]",
+			Flags: []Flag{
+				{Name: "needinfo", Requestee: "manager@mozilla.com", Setter: "sheriff@mozilla.com"},
+				{Name: "qe-verify", Status: "+"},
+			}},
 		{ID: 11, Summary: "Perma talos regression", Component: "Talos",
-			AssignedTo: "nobody@mozilla.org"},
+			AssignedTo: "nobody@mozilla.org", Keywords: []string{"intermittent-failure", "stalled"}, CommentCount: 212, Priority: "--"},
 	}}
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -411,7 +528,10 @@ func TestFetchPermaBugs(t *testing.T) {
 	bugzillaBase = server.URL
 	defer func() { bugzillaBase = old }()
 
-	bugs := fetchPermaBugs("2026-03-12", "2026-03-19")
+	bugs, err := fetchPermaBugs("2026-03-12", "2026-03-19")
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(bugs) != 2 {
 		t.Fatalf("got %d bugs, want 2", len(bugs))
@@ -423,6 +543,9 @@ func TestFetchPermaBugs(t *testing.T) {
 	if bugs[0].Needinfo != "manager@mozilla.com" {
 		t.Errorf("needinfo: got %q, want %q", bugs[0].Needinfo, "manager@mozilla.com")
 	}
+	if bugs[0].NeedinfoSetter != "sheriff@mozilla.com" {
+		t.Errorf("needinfo setter: got %q, want %q", bugs[0].NeedinfoSetter, "sheriff@mozilla.com")
+	}
 	if bugs[1].Assignee != "" {
 		t.Errorf("nobody@mozilla.org should be treated as unassigned, got %q", bugs[1].Assignee)
 	}
@@ -432,6 +555,24 @@ func TestFetchPermaBugs(t *testing.T) {
 	if bugs[0].Component != "Raptor" {
 		t.Errorf("component: got %q, want Raptor", bugs[0].Component)
 	}
+	if bugs[0].QAContact != "qa@mozilla.com" || bugs[0].Verification != "+" {
+		t.Errorf("QA: got %q/%q, want qa@mozilla.com/+", bugs[0].QAContact, bugs[0].Verification)
+	}
+	if bugs[1].Verification != "" {
+		t.Errorf("verification without qe-verify flag: got %q, want empty", bugs[1].Verification)
+	}
+	if bugs[0].Priority != "P2" || bugs[0].Whiteboard != "[perftest:triage]" {
+		t.Errorf("priority/whiteboard: got %q/%q, want P2/[perftest:triage]", bugs[0].Priority, bugs[0].Whiteboard)
+	}
+	if bugs[1].Priority != "" {
+		t.Errorf("unprioritized bug: got priority %q, want empty", bugs[1].Priority)
+	}
+	if bugs[1].CommentCount != 212 {
+		t.Errorf("comment count: got %d, want 212", bugs[1].CommentCount)
+	}
+	if bugs[0].Stalled || !bugs[1].Stalled {
+		t.Errorf("stalled: got %v/%v, want false/true", bugs[0].Stalled, bugs[1].Stalled)
+	}
 }
 
 func TestAnalyzeTaskTimeout(t *testing.T) {
@@ -595,3 +736,1953 @@ func TestGetRetryExhausted(t *testing.T) {
 		t.Errorf("expected 3 attempts, got %d", attempts.Load())
 	}
 }
+
+func TestLoadDisplayLocation(t *testing.T) {
+	if got := loadDisplayLocation("Europe/Berlin"); got.String() != "Europe/Berlin" {
+		t.Errorf("got %q, want Europe/Berlin", got)
+	}
+	if got := loadDisplayLocation("Not/AZone"); got != time.UTC {
+		t.Errorf("invalid zone should fall back to UTC, got %q", got)
+	}
+}
+
+func TestParseBugIDs(t *testing.T) {
+	ids, err := parseBugIDs(" 1234, 5678,,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1234 || ids[1] != 5678 {
+		t.Errorf("got %v, want [1234 5678]", ids)
+	}
+	if _, err := parseBugIDs("1234,abc"); err == nil {
+		t.Error("expected error for non-numeric ID")
+	}
+}
+
+func TestDaysSince(t *testing.T) {
+	now := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		date string
+		want int
+	}{
+		{"2025-03-03", 7},
+		{"2025-03-10", 1},
+		{"2025-02-28", 10},
+	}
+	for _, tt := range tests {
+		got, err := daysSince(tt.date, now)
+		if err != nil {
+			t.Errorf("daysSince(%q): %v", tt.date, err)
+		} else if got != tt.want {
+			t.Errorf("daysSince(%q) = %d, want %d", tt.date, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"2025-03-11", "03/03/2025"} {
+		if _, err := daysSince(bad, now); err == nil {
+			t.Errorf("daysSince(%q): expected error", bad)
+		}
+	}
+}
+
+func TestLinkedTo(t *testing.T) {
+	tests := []struct {
+		bug  Bug
+		want bool
+	}{
+		{Bug{ID: 1, DupeOf: 500}, true},
+		{Bug{ID: 2, Blocks: []int{10, 500}}, true},
+		{Bug{ID: 3, DependsOn: []int{500}}, true},
+		{Bug{ID: 4, Blocks: []int{10}}, false},
+	}
+	for _, tt := range tests {
+		if got := linkedTo(tt.bug, 500); got != tt.want {
+			t.Errorf("linkedTo(bug %d) = %v, want %v", tt.bug.ID, got, tt.want)
+		}
+	}
+	if linkedTo(Bug{ID: 5}, 0) {
+		t.Error("linkedTo with no meta bug should be false")
+	}
+}
+
+func TestSearchURLs(t *testing.T) {
+	u, err := url.Parse(searchURL(permaSearch("2026-03-12"), 0))
+	if err != nil {
+		t.Fatalf("bad URL: %v", err)
+	}
+	q := u.Query()
+	if q.Get("short_desc") != "Perma" || q.Get("last_change_time") != "2026-03-12" || q.Get("offset") != "0" {
+		t.Errorf("unexpected perma query: %v", q)
+	}
+	if got := q["component"]; len(got) != len(components) {
+		t.Errorf("components: got %v, want %v", got, components)
+	}
+	if q := intermittentSearch(); q.Get("keywords") != "intermittent-failure" {
+		t.Errorf("unexpected intermittent query: %v", q)
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	saved := products
+	defer func() { products = saved }()
+	products = []string{"Testing", "Core"}
+	for name, q := range map[string]url.Values{"intermittent": intermittentSearch(), "perma": permaSearch("2026-03-12")} {
+		if got := q["product"]; !slices.Equal(got, products) {
+			t.Errorf("%s products: got %v, want %v", name, got, products)
+		}
+	}
+}
+
+func TestSearchBugsPaginates(t *testing.T) {
+	var offsets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		offsets = append(offsets, q.Get("offset"))
+		if q.Get("limit") != "2" {
+			t.Errorf("limit: got %q, want 2", q.Get("limit"))
+		}
+		pages := map[string][]Bug{"0": {{ID: 1}, {ID: 2}}, "2": {{ID: 3}, {ID: 4}}, "4": {{ID: 5}}}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(BugListResponse{Bugs: pages[q.Get("offset")]}); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	oldBase, oldSize := bugzillaBase, bugPageSize
+	bugzillaBase = server.URL
+	bugPageSize = 2
+	defer func() { bugzillaBase, bugPageSize = oldBase, oldSize }()
+
+	bugs, err := searchBugs(url.Values{"product": {"Testing"}}, "bugs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bugs) != 5 || bugs[4].ID != 5 {
+		t.Errorf("got %+v, want bugs 1-5", bugs)
+	}
+	if strings.Join(offsets, ",") != "0,2,4" {
+		t.Errorf("offsets: got %v, want [0 2 4]", offsets)
+	}
+}
+
+func TestSearchFailureReturnsError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html>maintenance</html>`))
+	}))
+	defer server.Close()
+
+	old := bugzillaBase
+	bugzillaBase = server.URL
+	defer func() { bugzillaBase = old }()
+
+	if bugs, err := fetchIntermittentBugs(); err == nil || bugs != nil {
+		t.Errorf("intermittents: got %v, %v; want an error", bugs, err)
+	}
+	if permas, err := fetchPermaBugs("2026-03-12", "2026-03-19"); err == nil || permas != nil {
+		t.Errorf("permas: got %v, %v; want an error", permas, err)
+	}
+}
+
+func TestBugzillaErrorEnvelope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":true,"message":"The field 'bogus' is not valid.","code":108}`))
+	}))
+	defer server.Close()
+
+	old := bugzillaBase
+	bugzillaBase = server.URL
+	defer func() { bugzillaBase = old }()
+
+	_, err := fetchIntermittentBugs()
+	if err == nil || !strings.Contains(err.Error(), "bugzilla error 108: The field 'bogus' is not valid.") {
+		t.Errorf("search: got %v, want the Bugzilla message", err)
+	}
+	if _, err := fetchBugsByID([]int{1}); err == nil || !strings.Contains(err.Error(), "bugzilla error 108") {
+		t.Errorf("by ID: got %v, want the Bugzilla message", err)
+	}
+}
+
+func TestFetchBugsByID(t *testing.T) {
+	var gotIDs string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIDs = r.URL.Query().Get("id")
+		w.Header().Set("Content-Type", "application/json")
+		payload := BugListResponse{Bugs: []Bug{{ID: 1}, {ID: 2}}}
+		if err := json.NewEncoder(w).Encode(payload); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	old := bugzillaBase
+	bugzillaBase = server.URL
+	defer func() { bugzillaBase = old }()
+
+	bugs, err := fetchBugsByID([]int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotIDs != "1,2" {
+		t.Errorf("id param: got %q, want %q", gotIDs, "1,2")
+	}
+	if len(bugs) != 2 {
+		t.Errorf("got %d bugs, want 2", len(bugs))
+	}
+}
+
+func TestBreakdownTotal(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  int
+	}{
+		{"simple", []string{"autoland: 3", "mozilla-central: 12"}, 15},
+		{"unparseable lines skipped", []string{"autoland: 3", "garbage", "try: n/a"}, 3},
+		{"thousands separator", []string{"autoland: 1,234", "try: 6"}, 1240},
+		{"colons in name", []string{"raptor-tp6: firefox: 4", "talos:5"}, 9},
+		{"empty", nil, 0},
+	}
+	for _, tt := range tests {
+		if got := breakdownTotal(tt.lines); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCountsDisagree(t *testing.T) {
+	tests := []struct {
+		count, sum int
+		want       bool
+	}{
+		{100, 100, false},
+		{100, 95, false}, // within 10%
+		{100, 60, true},
+		{3, 1, false}, // small absolute difference
+		{20, 0, true},
+	}
+	for _, tt := range tests {
+		if got := countsDisagree(tt.count, tt.sum); got != tt.want {
+			t.Errorf("countsDisagree(%d, %d) = %v, want %v", tt.count, tt.sum, got, tt.want)
+		}
+	}
+}
+
+func TestGetSendsAPIKeyOnlyToBugzilla(t *testing.T) {
+	var bugzillaKey, treeherderKey string
+	bz := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bugzillaKey = r.Header.Get("X-BUGZILLA-API-KEY")
+	}))
+	defer bz.Close()
+	th := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		treeherderKey = r.Header.Get("X-BUGZILLA-API-KEY")
+	}))
+	defer th.Close()
+
+	oldBase, oldKey := bugzillaBase, bugzillaAPIKey
+	bugzillaBase = bz.URL + "/rest/bug"
+	bugzillaAPIKey = "secret"
+	defer func() { bugzillaBase, bugzillaAPIKey = oldBase, oldKey }()
+
+	for _, u := range []string{bz.URL + "/rest/product/Testing", th.URL + "/failures/"} {
+		resp, err := get(u)
+		if err != nil {
+			t.Fatalf("get %s: %v", u, err)
+		}
+		_ = resp.Body.Close()
+	}
+	if bugzillaKey != "secret" {
+		t.Errorf("Bugzilla request: got key %q, want %q", bugzillaKey, "secret")
+	}
+	if treeherderKey != "" {
+		t.Errorf("Treeherder request should not carry the key, got %q", treeherderKey)
+	}
+}
+
+func TestSetProxy(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host == "bugzilla.invalid" {
+			proxied.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	oldTransport := httpClient.Transport
+	defer func() { httpClient.Transport = oldTransport }()
+
+	if err := setProxy(proxy.URL); err != nil {
+		t.Fatalf("setProxy: %v", err)
+	}
+	resp, err := get("http://bugzilla.invalid/rest/bug")
+	if err != nil {
+		t.Fatalf("get through proxy: %v", err)
+	}
+	_ = resp.Body.Close()
+	if proxied.Load() != 1 {
+		t.Errorf("expected request to go through proxy, got %d proxied requests", proxied.Load())
+	}
+
+	if err := setProxy("not a url"); err == nil {
+		t.Error("expected error for invalid proxy URL")
+	}
+}
+
+func TestPrintBugDetail(t *testing.T) {
+	oldDays := daysBack
+	daysBack = 7
+	defer func() { daysBack = oldDays }()
+
+	var buf bytes.Buffer
+	printBugDetail(&buf, Result{
+		ID: 1234, Summary: "Intermittent raptor timeout", Component: "Raptor",
+		NumberFailures: 42, Rate: "3.1%", TestRuns: 1355, Trend: "↑ +10",
+		Platforms: []PlatformCount{{"linux1804", 40}, {"windows11", 2}}, BreakdownList: []string{"autoland: 42"},
+		Assignee: "dev@mozilla.com",
+	})
+
+	out := buf.String()
+	for _, want := range []string{
+		"Bug 1234 - Intermittent raptor timeout",
+		"42 (3.1% rate over 1355 runs) ↑ +10",
+		"linux1804: 40, windows11: 2",
+		"dev@mozilla.com",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "2d failures") || strings.Contains(out, "NEEDINFO") {
+		t.Errorf("empty fields should be omitted:\n%s", out)
+	}
+}
+
+func TestRunbooks(t *testing.T) {
+	input := `# test runbooks
+*raptor*speedometer*  https://wiki.example.com/speedometer
+
+*talos*               https://wiki.example.com/talos
+`
+	parsed, err := parseRunbooks(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseRunbooks: %v", err)
+	}
+	old := runbooks
+	runbooks = parsed
+	defer func() { runbooks = old }()
+
+	tests := []struct {
+		summary, want string
+	}{
+		{"Intermittent Raptor speedometer3 | application timed out", "https://wiki.example.com/speedometer"},
+		{"Intermittent testing/talos/tests/g5 failure", "https://wiki.example.com/talos"},
+		{"Intermittent AWSY failure", ""},
+	}
+	for _, tt := range tests {
+		if got := runbookFor(tt.summary); got != tt.want {
+			t.Errorf("runbookFor(%q) = %q, want %q", tt.summary, got, tt.want)
+		}
+	}
+
+	if _, err := parseRunbooks(strings.NewReader("*raptor*\n")); err == nil {
+		t.Error("expected error for line without URL")
+	}
+}
+
+func TestRenderHTMLBranding(t *testing.T) {
+	var buf bytes.Buffer
+	data := reportData{
+		Generated:   "2026-03-19 09:00 UTC",
+		DaysBack:    7,
+		LogoURL:     "https://example.com/logo.png",
+		AccentColor: "#0060df",
+	}
+	if err := renderHTML(&buf, reportTemplate, data); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{`src="https://example.com/logo.png"`, "border-bottom: 2px solid #0060df"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in HTML output", want)
+		}
+	}
+
+	buf.Reset()
+	if err := renderHTML(&buf, reportTemplate, reportData{DaysBack: 7}); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "<img") || strings.Contains(buf.String(), "border-bottom") {
+		t.Error("default report should not include branding")
+	}
+}
+
+func TestCustomTemplate(t *testing.T) {
+	old := htmlTemplate
+	htmlTemplate = `<h1>{{len .Intermittents}} {{t "Intermittent Failures"}}</h1>`
+	defer func() { htmlTemplate = old }()
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	results := []Result{{ID: 1, Component: "Raptor"}}
+	if err := writeHTMLReport(path, results, nil, nil, nil, nil); err != nil {
+		t.Fatalf("writeHTMLReport failed: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "<h1>1 Intermittent Failures</h1>" {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := parseTemplate(`{{if .Broken}`); err == nil {
+		t.Error("expected a parse error for a broken template")
+	}
+}
+
+func TestRenderHTMLTruncated(t *testing.T) {
+	data := reportData{DaysBack: 7, Summary: ReportSummary{Intermittents: 30}, TruncatedFrom: 212}
+	var buf bytes.Buffer
+	if err := renderHTML(&buf, reportTemplate, data); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "(showing top 30 out of 212)") {
+		t.Errorf("expected truncation note in:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderHTML(&buf, reportTemplate, reportData{DaysBack: 7, HiddenNeedinfo: 4}); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "4 bugs with an open needinfo hidden") {
+		t.Errorf("expected hidden needinfo note in:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := renderHTML(&buf, reportTemplate, reportData{DaysBack: 7, FailedSearches: []string{"perma bugs"}}); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "perma bugs could not be fetched") {
+		t.Errorf("expected failed search note in:\n%s", buf.String())
+	}
+}
+
+func TestRenderHTMLTranslated(t *testing.T) {
+	old := lang
+	lang = "de"
+	defer func() { lang = old }()
+
+	data := reportData{DaysBack: 7, Lang: lang, Intermittents: []ComponentGroup[Result]{{
+		Name: "Raptor",
+		Bugs: []Result{{ID: 1, Summary: "Intermittent raptor failure", NumberFailures: 30, Assignee: "dev@mozilla.com"}},
+	}}}
+	var buf bytes.Buffer
+	if err := renderHTML(&buf, reportTemplate, data); err != nil {
+		t.Fatalf("renderHTML failed: %v", err)
+	}
+	html := buf.String()
+	for _, want := range []string{`<html lang="de">`, "Sporadische Fehler", "<b>30</b> Fehler", "Zugewiesen an", "Intermittent raptor failure"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in HTML output", want)
+		}
+	}
+	if translate("de", "no such label") != "no such label" {
+		t.Error("missing translations should fall back to English")
+	}
+}
+
+func TestFetchReopened(t *testing.T) {
+	histories := map[string]string{
+		"/100/history": `{"bugs":[{"history":[{"changes":[{"field_name":"status","removed":"RESOLVED","added":"REOPENED"}]}]}]}`,
+		"/200/history": `{"bugs":[{"history":[{"changes":[{"field_name":"status","removed":"NEW","added":"ASSIGNED"}]}]}]}`,
+		"/300/history": `{"bugs":[{"history":[]}]}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("new_since") != "2026-03-12" {
+			t.Errorf("new_since: got %q", r.URL.Query().Get("new_since"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(histories[r.URL.Path]))
+	}))
+	defer server.Close()
+
+	old := bugzillaBase
+	bugzillaBase = server.URL
+	defer func() { bugzillaBase = old }()
+
+	for id, want := range map[int]bool{100: true, 200: false, 300: false} {
+		if got := fetchReopened(id, "2026-03-12"); got != want {
+			t.Errorf("fetchReopened(%d) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestPlatformBreakdownFrom(t *testing.T) {
+	var failures []THJobFailure
+	for raw, n := range map[string]int{"windows11-64-2009-shippable": 2, "android-hw-a55-14-0-arm64-shippable": 30, "linux1804-64-shippable-qr": 2, "macosx1470-64-shippable": 9} {
+		for range n {
+			failures = append(failures, THJobFailure{Platform: raw})
+		}
+	}
+	want := []PlatformCount{{"android-hw-a55", 30}, {"macosx1470", 9}, {"linux1804", 2}, {"windows11", 2}}
+	if got := platformBreakdownFrom(failures); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDistinctPlatforms(t *testing.T) {
+	results := []Result{
+		{Platforms: []PlatformCount{{"linux1804", 3}, {"windows11", 1}}},
+		{Platforms: []PlatformCount{{"linux1804", 7}, {"android-hw-a55", 2}}},
+	}
+	permas := []PermaBug{{Platforms: []PlatformCount{{"macosx1470", 4}}}}
+
+	got := distinctPlatforms(results, permas)
+	want := []string{"android-hw-a55", "linux1804", "macosx1470", "windows11"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPercentileThreshold(t *testing.T) {
+	bugs := []Bug{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	counts := map[int]int{1: 40, 2: 5, 3: 12, 4: 80} // bug 5 never failed
+	tests := []struct {
+		p    float64
+		want int
+	}{
+		{50, 12},
+		{75, 40},
+		{100, 80},
+		{1, 5},
+	}
+	for _, tt := range tests {
+		if got := percentileThreshold(bugs, counts, tt.p); got != tt.want {
+			t.Errorf("percentileThreshold(p=%v) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestMissingBreakdowns(t *testing.T) {
+	results := []Result{
+		{ID: 1, NumberFailures: 30, Platforms: []PlatformCount{{"linux1804", 30}}, BreakdownList: []string{"autoland: 30"}},
+		{ID: 2, NumberFailures: 25},
+		{ID: 3, NumberFailures: 0},
+		{ID: 4, NumberFailures: 21, BreakdownList: []string{"autoland: 21"}},
+	}
+	got := missingBreakdowns(results)
+	if len(got) != 1 || got[0] != 2 {
+		t.Errorf("got %v, want [2]", got)
+	}
+}
+
+func TestAnalysisFailuresRecorded(t *testing.T) {
+	maxConcurrent = 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "failuresbybug") {
+			_, _ = w.Write([]byte(`<html>maintenance</html>`))
+			return
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	analysisErrors.byBug = nil
+	defer func() { treeherderBase = old; analysisErrors.byBug = nil }()
+
+	results := analyzeBugs([]Bug{{ID: 7}}, "2026-03-12", "2026-03-19", map[int]int{7: 30}, nil, "2026-03-17", nil)
+	if len(results) != 1 {
+		t.Fatalf("bug should still be reported with partial data, got %d results", len(results))
+	}
+	failed := analysisFailures()
+	if len(failed) != 1 || failed[0].ID != 7 || !strings.HasPrefix(failed[0].Reason, "failure breakdown:") {
+		t.Errorf("got %+v, want one failure breakdown error for bug 7", failed)
+	}
+}
+
+func TestAnalyzeBugsNonPositiveConcurrency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	oldBase, oldConcurrent := treeherderBase, maxConcurrent
+	treeherderBase = server.URL
+	defer func() { treeherderBase, maxConcurrent = oldBase, oldConcurrent }()
+
+	for _, n := range []int{0, -3} {
+		setConcurrency(n)
+		done := make(chan []Result)
+		go func() {
+			done <- analyzeBugs([]Bug{{ID: 1}, {ID: 2}}, "2026-03-12", "2026-03-19", map[int]int{1: 30, 2: 25}, nil, "2026-03-17", nil)
+		}()
+		select {
+		case results := <-done:
+			if len(results) != 2 {
+				t.Errorf("concurrency %d: got %d results, want 2", n, len(results))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("concurrency %d: analyzeBugs hung", n)
+		}
+	}
+}
+
+func TestRecoverAnalysis(t *testing.T) {
+	analysisErrors.byBug = nil
+	defer func() { analysisErrors.byBug = nil }()
+
+	func() {
+		defer recoverAnalysis(9)
+		var platforms []string
+		_ = platforms[3] // out of range
+	}()
+	failed := analysisFailures()
+	if len(failed) != 1 || failed[0].ID != 9 || !strings.HasPrefix(failed[0].Reason, "panic:") {
+		t.Errorf("got %+v, want a panic recorded for bug 9", failed)
+	}
+}
+
+func TestAnalyzeAllZeroThreshold(t *testing.T) {
+	maxConcurrent = 5
+	oldThreshold := threshold
+	t.Cleanup(func() { threshold = oldThreshold })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+
+	bugs := []Bug{{ID: 100}, {ID: 200}}
+	counts := map[int]int{200: 1}
+
+	threshold = 0
+	results := analyzeAll(bugs, "2026-03-12", "2026-03-19", counts, nil, "2026-03-17", nil)
+	if len(results) != 1 || results[0].ID != 200 {
+		t.Errorf("threshold 0: got %+v, want only bug 200", results)
+	}
+
+	// explicit bug lists report everything, failing or not
+	threshold = -1
+	results = analyzeAll(bugs, "2026-03-12", "2026-03-19", counts, nil, "2026-03-17", nil)
+	if len(results) != 2 {
+		t.Errorf("threshold -1: got %d results, want 2", len(results))
+	}
+}
+
+func TestAnalyzeBelowThreshold(t *testing.T) {
+	maxConcurrent = 5
+	oldThreshold := threshold
+	threshold = 20
+	t.Cleanup(func() { threshold = oldThreshold })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+
+	bugs := []Bug{{ID: 100}, {ID: 200}, {ID: 300}}
+	counts := map[int]int{100: 50, 200: 10}
+	below := analyzeBelowThreshold(bugs, "2026-03-12", "2026-03-19", counts, map[int]int{}, "2026-03-17", map[int]int{})
+
+	// 100 is over threshold and 300 has no failures at all
+	if len(below) != 1 || below[0].ID != 200 {
+		t.Fatalf("got %+v, want only bug 200", below)
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		input string
+		want  PlatformInfo
+	}{
+		{"windows11-64-2009-shippable", PlatformInfo{"windows", "11", "2009"}},
+		{"windows11-64-24h2-shippable", PlatformInfo{"windows", "11", "24h2"}},
+		{"windows10-64-2009-shippable-qr", PlatformInfo{"windows", "10", "2009"}},
+		{"windows11-aarch64-shippable", PlatformInfo{"windows", "11", ""}},
+		{"linux1804-64-shippable-qr", PlatformInfo{"linux", "1804", ""}},
+		{"linux2404-64-shippable", PlatformInfo{"linux", "2404", ""}},
+		{"macosx1470-64-shippable", PlatformInfo{"macosx", "1470", ""}},
+		{"android-hw-a55-14-0-arm64-shippable", PlatformInfo{"android", "14.0", ""}},
+		{"android-em-7-0-x86_64-qr", PlatformInfo{"android", "7.0", ""}},
+		{"windows11", PlatformInfo{"windows", "11", ""}},
+		{"osx1015-64-shippable", PlatformInfo{"macosx", "1015", ""}},
+		{"win10-64-shippable", PlatformInfo{"windows", "10", ""}},
+		{"ubuntu2204-64", PlatformInfo{"linux", "2204", ""}},
+		{"a51-11-0-aarch64-shippable", PlatformInfo{"android", "11.0", ""}},
+		{"p6", PlatformInfo{"android", "", ""}},
+		{"toolchains", PlatformInfo{}},
+		{"", PlatformInfo{}},
+	}
+	for _, tt := range tests {
+		// versions come from the raw names Treeherder reports, which is
+		// what aggregateBreakdown parses before normalizing
+		_, _, got := aggregateBreakdown([]THJobFailure{{Platform: tt.input}})
+		var want []PlatformInfo
+		if tt.want.Family != "" {
+			want = []PlatformInfo{tt.want}
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: got %+v, want %+v", tt.input, got, want)
+		}
+	}
+}
+
+func TestPlatformFamiliesExtensible(t *testing.T) {
+	platformFamilies["fuchsia"] = "fuchsia"
+	defer delete(platformFamilies, "fuchsia")
+
+	if got := parsePlatform("fuchsia12-x64"); got != (PlatformInfo{"fuchsia", "12", ""}) {
+		t.Errorf("got %+v, want the added fuchsia family", got)
+	}
+	_, platforms, _ := aggregateBreakdown([]THJobFailure{{Platform: "fuchsia12-x64-shippable"}, {Platform: "toolchains", TestSuite: "toolchain-fuchsia-sdk"}})
+	if want := []PlatformCount{{"fuchsia", 1}, {"fuchsia12", 1}}; !slices.Equal(platforms, want) {
+		t.Errorf("captured %v, want %v", platforms, want)
+	}
+	groups := groupByPlatform([]Result{{ID: 1, Platforms: []PlatformCount{{"osx1015-64", 2}, {"android-em-7-0-x86_64", 1}, {"fuchsia12-x64", 1}}}})
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	if !slices.Equal(names, []string{"android", "fuchsia", "macosx"}) {
+		t.Errorf("got groups %v", names)
+	}
+}
+
+func TestPlatformCountJSON(t *testing.T) {
+	var got []PlatformCount
+	if err := json.Unmarshal([]byte(`[{"name":"linux1804-64","count":18},"windows11-64: 1"]`), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []PlatformCount{{"linux1804-64", 18}, {"windows11-64", 1}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if s := got[0].String(); s != "linux1804-64: 18" {
+		t.Errorf("String: got %q", s)
+	}
+}
+
+func TestMatchesOSVersion(t *testing.T) {
+	_, _, versions := aggregateBreakdown([]THJobFailure{
+		{Platform: "linux1804-64-shippable-qr"},
+		{Platform: "windows11-64-24h2-shippable"},
+		{Platform: "android-hw-a55-14-0-arm64-shippable"},
+	})
+	for _, want := range []string{"Windows11", "linux1804", "android14", "android14.0"} {
+		if !matchesOSVersion(versions, want) {
+			t.Errorf("%s: expected a match in %v", want, versions)
+		}
+	}
+	for _, want := range []string{"windows10", "android13", "android", "linux"} {
+		if matchesOSVersion(versions, want) {
+			t.Errorf("%s should not match %v", want, versions)
+		}
+	}
+}
+
+func TestReportFiltersBelowThreshold(t *testing.T) {
+	android := []PlatformCount{{"android-hw-a55", 3}, {"windows11", 1}}
+	windows := []PlatformCount{{"windows11", 2}}
+	results := []Result{{ID: 1, Platforms: android}, {ID: 2, Platforms: windows}}
+	below := []Result{{ID: 3, Platforms: slices.Clone(android)}, {ID: 4, Platforms: windows}, {ID: 5, Platforms: android, Needinfo: "lead@mozilla.com"}}
+	permas := []PermaBug{{ID: 6, Platforms: windows}}
+
+	f := reportFilters{platforms: []string{"android"}, hideNeedinfo: true}
+	results, below, permas, hidden := f.apply(results, below, permas)
+	if len(results) != 1 || results[0].ID != 1 || len(permas) != 0 {
+		t.Errorf("got results %+v, permas %+v", results, permas)
+	}
+	if len(below) != 1 || below[0].ID != 3 {
+		t.Fatalf("below threshold: got %+v, want only bug 3", below)
+	}
+	if want := []PlatformCount{{"android-hw-a55", 3}}; !slices.Equal(below[0].Platforms, want) {
+		t.Errorf("below-threshold platforms: got %v, want %v", below[0].Platforms, want)
+	}
+	if hidden != 0 {
+		t.Errorf("hidden for needinfo: got %d, want 0 outside the below-threshold list", hidden)
+	}
+
+	_, below, _, _ = reportFilters{osVersion: "windows11"}.apply(nil, []Result{{ID: 7, OSVersions: []PlatformInfo{{"android", "14.0", ""}}}}, nil)
+	if len(below) != 0 {
+		t.Errorf("--os-version: got %+v, want the below-threshold bug dropped", below)
+	}
+}
+
+func TestMatchingPlatforms(t *testing.T) {
+	var failures []THJobFailure
+	for raw, n := range map[string]int{
+		"android-hw-a55-14-0-arm64-shippable": 6,
+		"windows11-64-24h2-shippable":         4,
+		"osx1015-64-shippable":                2,
+		"linux2404-64-shippable":              1,
+	} {
+		for range n {
+			failures = append(failures, THJobFailure{Platform: raw})
+		}
+	}
+	// --platform filters the normalized names the report holds
+	_, platforms, _ := aggregateBreakdown(failures)
+	if want := []PlatformCount{{"android-hw-a55", 6}, {"windows11", 4}, {"osx1015", 2}, {"linux2404", 1}}; !slices.Equal(platforms, want) {
+		t.Fatalf("normalized %v, want %v", platforms, want)
+	}
+	tests := []struct {
+		filters []string
+		want    []PlatformCount
+	}{
+		{[]string{"Android"}, platforms[:1]},
+		{[]string{"win"}, platforms[1:2]},
+		{[]string{"macosx"}, platforms[2:3]},
+		{[]string{"a55", "linux"}, []PlatformCount{platforms[0], platforms[3]}},
+		{[]string{"ios"}, nil},
+	}
+	for _, tt := range tests {
+		if got := matchingPlatforms(platforms, tt.filters); !slices.Equal(got, tt.want) {
+			t.Errorf("%v: got %v, want %v", tt.filters, got, tt.want)
+		}
+	}
+}
+
+func TestSortRepos(t *testing.T) {
+	old := repoOrder
+	defer func() { repoOrder = old }()
+
+	lines := func() []string {
+		return []string{"try: 9", "mozilla-beta: 1", "mozilla-central: 4", "autoland: 2", "mozilla-release: 3"}
+	}
+
+	repoOrder = nil
+	got := lines()
+	sortRepos(got)
+	want := "autoland: 2,mozilla-beta: 1,mozilla-central: 4,mozilla-release: 3,try: 9"
+	if strings.Join(got, ",") != want {
+		t.Errorf("default order: got %v, want %s", got, want)
+	}
+
+	repoOrder = []string{"autoland", "mozilla-central", "*", "try"}
+	got = lines()
+	sortRepos(got)
+	want = "autoland: 2,mozilla-central: 4,mozilla-beta: 1,mozilla-release: 3,try: 9"
+	if strings.Join(got, ",") != want {
+		t.Errorf("priority order: got %v, want %s", got, want)
+	}
+}
+
+func TestAnalyzeBugsStopsWhenRunCancelled(t *testing.T) {
+	maxConcurrent = 5
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	oldCtx := runCtx
+	runCtx = ctx
+	defer func() { runCtx = oldCtx }()
+
+	results := analyzeBugs([]Bug{{ID: 1}, {ID: 2}}, "2026-03-12", "2026-03-19", map[int]int{1: 30, 2: 40}, nil, "2026-03-17", nil)
+	if len(results) != 0 {
+		t.Errorf("got %d results, want none once the run is cancelled", len(results))
+	}
+	if _, err := get(server.URL); err == nil {
+		t.Error("get should fail once the run is cancelled")
+	}
+	if requests.Load() != 0 {
+		t.Errorf("expected no requests after cancellation, got %d", requests.Load())
+	}
+}
+
+func TestGroupByPlatform(t *testing.T) {
+	results := []Result{
+		{ID: 1, NumberFailures: 80, Platforms: []PlatformCount{{"android-hw-a55", 70}, {"linux1804", 10}}},
+		{ID: 2, NumberFailures: 50, Platforms: []PlatformCount{{"linux1804", 20}, {"linux2404", 30}}},
+		{ID: 3, NumberFailures: 30, Platforms: []PlatformCount{{"windows11", 30}}},
+	}
+	groups := groupByPlatform(results)
+
+	var got []string
+	for _, g := range groups {
+		var ids []string
+		for _, b := range g.Bugs {
+			ids = append(ids, fmt.Sprint(b.ID))
+		}
+		got = append(got, g.Name+"="+strings.Join(ids, ","))
+	}
+	// bug 2 fails on two linux versions but should only be listed once under linux
+	want := "android=1 linux=1,2 windows=3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestAnnotateOutliers(t *testing.T) {
+	var results []Result
+	for i := 1; i <= 20; i++ {
+		results = append(results, Result{ID: i, NumberFailures: i * 5})
+	}
+	stats := annotateOutliers(results)
+	if stats != (FailureStats{Median: 50, P90: 90}) {
+		t.Errorf("got %+v, want median 50, p90 90", stats)
+	}
+	var above []int
+	for _, r := range results {
+		if r.AboveP90 {
+			above = append(above, r.ID)
+		}
+	}
+	if !slices.Equal(above, []int{19, 20}) {
+		t.Errorf("above p90: got %v, want [19 20]", above)
+	}
+	if got := annotateOutliers(nil); got != (FailureStats{}) {
+		t.Errorf("empty: got %+v", got)
+	}
+}
+
+func TestRollUpSmallGroups(t *testing.T) {
+	groups := []ComponentGroup[Result]{
+		{Name: "AWSY", Bugs: []Result{{ID: 1}}},
+		{Name: "Raptor", Bugs: []Result{{ID: 2}, {ID: 3}, {ID: 4}}},
+		{Name: "Talos", Bugs: []Result{{ID: 5}}},
+	}
+	got := rollUpSmallGroups(groups, 2)
+	if len(got) != 2 || got[0].Name != "Raptor" || got[1].Name != "Other" {
+		t.Fatalf("got %+v, want Raptor then Other", got)
+	}
+	if len(got[1].Bugs) != 2 || got[1].Bugs[0].ID != 1 || got[1].Bugs[1].ID != 5 {
+		t.Errorf("Other bugs: got %+v, want 1 and 5", got[1].Bugs)
+	}
+	if got := rollUpSmallGroups(groups, 0); len(got) != 3 {
+		t.Errorf("min 0 should keep every group, got %d", len(got))
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	results := []Result{
+		{ID: 1, NumberFailures: 40, Assignee: "dev@mozilla.com", Needinfo: "sheriff@mozilla.com"},
+		{ID: 2, NumberFailures: 25},
+	}
+	permas := []PermaBug{{ID: 3, NumberFailures: 12, Needinfo: "dev@mozilla.com"}}
+
+	got := summarize(results, permas)
+	want := ReportSummary{Intermittents: 2, Permas: 1, Failures: 77, Unassigned: 2, Needinfo: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestNeedinfoAging(t *testing.T) {
+	daysAgo := func(d int) string { return time.Now().UTC().AddDate(0, 0, -d).Format(time.RFC3339) }
+	results := []Result{
+		{ID: 1, Needinfo: "a@mozilla.com", NeedinfoCreated: daysAgo(1)},
+		{ID: 2, Needinfo: "b@mozilla.com", NeedinfoCreated: daysAgo(5)},
+		{ID: 3}, // no needinfo
+	}
+	permas := []PermaBug{
+		{ID: 4, Needinfo: "c@mozilla.com", NeedinfoCreated: daysAgo(10)},
+		{ID: 5, Needinfo: "d@mozilla.com", NeedinfoCreated: daysAgo(30)},
+	}
+	got := needinfoAging(results, permas)
+	want := NeedinfoAging{UnderThree: 1, ThreeToSeven: 1, OverSeven: 2}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReportIsDeterministic(t *testing.T) {
+	maxConcurrent = 8
+	oldThreshold := threshold
+	threshold = 1
+	t.Cleanup(func() { threshold = oldThreshold })
+
+	breakdownPayload := []THJobFailure{
+		{Platform: "linux1804-64-shippable-qr", Tree: "autoland", TestSuite: "raptor-tp6"},
+		{Platform: "windows11-64-2009-shippable", Tree: "mozilla-central", TestSuite: "talos-g5"},
+		{Platform: "android-hw-a55-14-0-arm64-shippable", Tree: "autoland", TestSuite: "raptor-speedometer"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(breakdownPayload); err != nil {
+			t.Errorf("failed to encode response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+
+	// many bugs sharing the same failure count so ordering depends on the tie-break
+	var bugs []Bug
+	counts := map[int]int{}
+	for i := 1; i <= 30; i++ {
+		comp := components[i%len(components)]
+		bugs = append(bugs, Bug{ID: i, Summary: fmt.Sprintf("Intermittent failure %d", i), Component: comp})
+		counts[i] = 10 + i%3
+	}
+
+	render := func() string {
+		results := analyzeAll(bugs, "2026-03-12", "2026-03-19", counts, counts, "2026-03-17", counts)
+		var buf bytes.Buffer
+		data := reportData{
+			Intermittents: groupByComponent(results, components),
+			Generated:     "2026-03-19 09:00 UTC",
+			DaysBack:      7,
+			Platforms:     distinctPlatforms(results, nil),
+		}
+		if err := renderHTML(&buf, reportTemplate, data); err != nil {
+			t.Fatalf("renderHTML failed: %v", err)
+		}
+		return buf.String()
+	}
+
+	first := render()
+	for range 5 {
+		if render() != first {
+			t.Fatal("rendered report differs between runs over the same input")
+		}
+	}
+}
+
+func TestBaselines(t *testing.T) {
+	parsed, err := parseBaselines(strings.NewReader("# SLO baselines\nRaptor 20\n1234 5\n\nTalos 40\n"))
+	if err != nil {
+		t.Fatalf("parseBaselines: %v", err)
+	}
+	old := baselines
+	baselines = parsed
+	defer func() { baselines = old }()
+
+	tests := []struct {
+		id        int
+		component string
+		want      int
+		wantOK    bool
+	}{
+		{1234, "Raptor", 5, true}, // bug-specific wins over component
+		{999, "Raptor", 20, true},
+		{999, "AWSY", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := baselineFor(tt.id, tt.component)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("baselineFor(%d, %q) = %d, %v; want %d, %v", tt.id, tt.component, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	if _, err := parseBaselines(strings.NewReader("Raptor twenty\n")); err == nil {
+		t.Error("expected error for non-numeric baseline")
+	}
+}
+
+func TestFetchTriageOwners(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/product/Testing":
+			_, _ = w.Write([]byte(`{"products":[{"components":[
+				{"name":"Raptor","triage_owner":"raptor-owner@mozilla.com"},
+				{"name":"Talos","triage_owner":"nobody@mozilla.org"}]}]}`))
+		case "/product/Core":
+			_, _ = w.Write([]byte(`{"products":[{"components":[
+				{"name":"Performance","triage_owner":"core-perf@mozilla.com"},
+				{"name":"Raptor","triage_owner":"someone-else@mozilla.com"}]}]}`))
+		default:
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	old, oldProducts := bugzillaBase, products
+	bugzillaBase = server.URL + "/bug"
+	products = []string{"Testing", "Core"}
+	defer func() { bugzillaBase, products = old, oldProducts }()
+
+	owners := fetchTriageOwners()
+	if owners["Raptor"] != "raptor-owner@mozilla.com" {
+		t.Errorf("Raptor owner: got %q, want the first product's", owners["Raptor"])
+	}
+	if owners["Performance"] != "core-perf@mozilla.com" {
+		t.Errorf("Core Performance owner: got %q", owners["Performance"])
+	}
+	if _, ok := owners["Talos"]; ok {
+		t.Error("nobody@mozilla.org should not be reported as an owner")
+	}
+}
+
+func TestCachedTriageOwners(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"products":[{"components":[{"name":"Raptor","triage_owner":"owner@mozilla.com"}]}]}`))
+	}))
+	defer server.Close()
+
+	oldBase, oldDir, oldTTL, oldRefresh := bugzillaBase, cacheDir, metadataTTL, refreshMetadata
+	bugzillaBase = server.URL + "/bug"
+	cacheDir = t.TempDir()
+	metadataTTL = time.Hour
+	defer func() { bugzillaBase, cacheDir, metadataTTL, refreshMetadata = oldBase, oldDir, oldTTL, oldRefresh }()
+
+	for i := 0; i < 2; i++ {
+		if got := cachedTriageOwners()["Raptor"]; got != "owner@mozilla.com" {
+			t.Fatalf("run %d: got owner %q", i, got)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected the second run to use the cache, got %d requests", n)
+	}
+
+	refreshMetadata = true
+	cachedTriageOwners()
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected --refresh-metadata to refetch, got %d requests", n)
+	}
+}
+
+func TestTreeherderCache(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"platform":"linux1804-64-shippable-qr","tree":"autoland","test_suite":"raptor-tp6"}]`))
+	}))
+	defer server.Close()
+
+	oldBase, oldDir, oldCache, oldNoCache := treeherderBase, cacheDir, treeherderCache, noCache
+	treeherderBase = server.URL
+	cacheDir = t.TempDir()
+	treeherderCache = true
+	defer func() { treeherderBase, cacheDir, treeherderCache, noCache = oldBase, oldDir, oldCache, oldNoCache }()
+
+	for i := 0; i < 2; i++ {
+		if breakdowns, _, _, _, _ := fetchTreeherderBreakdown(1234, "2026-03-12", "2026-03-19"); len(breakdowns) != 1 || breakdowns[0] != "autoland: 1" {
+			t.Fatalf("run %d: got %v", i, breakdowns)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected the second fetch to be cached, got %d requests", n)
+	}
+
+	// a different window is a different entry
+	fetchTreeherderBreakdown(1234, "2026-03-17", "2026-03-19")
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected a new window to be fetched, got %d requests", n)
+	}
+
+	noCache = true
+	fetchTreeherderBreakdown(1234, "2026-03-12", "2026-03-19")
+	if n := hits.Load(); n != 3 {
+		t.Errorf("expected --no-cache to refetch, got %d requests", n)
+	}
+}
+
+func TestTreeherderCacheToday(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"platform":"linux1804-64-shippable-qr","tree":"autoland","test_suite":"raptor-tp6"}]`))
+	}))
+	defer server.Close()
+
+	oldBase, oldDir, oldCache := treeherderBase, cacheDir, treeherderCache
+	treeherderBase = server.URL
+	cacheDir = t.TempDir()
+	treeherderCache = true
+	defer func() { treeherderBase, cacheDir, treeherderCache = oldBase, oldDir, oldCache }()
+
+	today := time.Now().UTC().Format("2006-01-02")
+	fetchTreeherderBreakdown(1234, "2026-01-01", today)
+	fetchTreeherderBreakdown(1234, "2026-01-01", today)
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("expected a fresh entry to be reused, got %d requests", n)
+	}
+
+	// an entry from earlier today no longer matches today's fresh counts
+	path := filepath.Join(cacheDir, "treeherder", "failuresbybug-1234-2026-01-01-"+today+".json")
+	earlier := time.Now().Add(-todayCacheTTL - time.Minute)
+	if err := os.Chtimes(path, earlier, earlier); err != nil {
+		t.Fatal(err)
+	}
+	fetchTreeherderBreakdown(1234, "2026-01-01", today)
+	if n := hits.Load(); n != 2 {
+		t.Errorf("expected a stale entry for today's window to be refetched, got %d requests", n)
+	}
+
+	noon := time.Date(2026, 3, 19, 12, 0, 0, 0, time.UTC)
+	if ttl := treeherderCacheTTL("2026-03-18", noon); ttl != 12*time.Hour {
+		t.Errorf("past window: got TTL %s, want the 12 hours since midnight", ttl)
+	}
+	if ttl := treeherderCacheTTL("2026-03-19", noon); ttl != todayCacheTTL {
+		t.Errorf("today's window: got TTL %s, want %s", ttl, todayCacheTTL)
+	}
+}
+
+func TestCountsStopAtMaxRuntime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runCtx = ctx
+	defer func() { runCtx = context.Background() }()
+
+	if _, _, _, err := fetchWindowCounts("2026-03-12", "2026-03-19", "2026-03-05", "2026-03-17"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want the run's context error", err)
+	}
+}
+
+func TestRegenerateKeepsReportOnCountsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+	retrySleep = func(time.Duration) {}
+	defer func() { retrySleep = func(d time.Duration) { time.Sleep(d) } }()
+
+	var current atomic.Pointer[servedReport]
+	previous := []byte("<html>previous</html>")
+	current.Store(&servedReport{page: previous, generated: time.Now()})
+	regenerate(&current, func() ([]byte, error) {
+		if _, _, _, err := fetchWindowCounts("2026-03-12", "2026-03-19", "2026-03-05", "2026-03-17"); err != nil {
+			return nil, err
+		}
+		return []byte("<html>new</html>"), nil
+	})
+
+	rec := httptest.NewRecorder()
+	reportHandler(&current, time.Hour).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(previous) {
+		t.Errorf("got %d %q, want the previous report", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	reportHandler(&current, time.Hour).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "500 Internal Server Error") {
+		t.Errorf("healthz: got %d %q, want 503 with the failure", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReportHandler(t *testing.T) {
+	var current atomic.Pointer[servedReport]
+	server := httptest.NewServer(reportHandler(&current, time.Hour))
+	defer server.Close()
+
+	fetch := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := fetch("/"); code != http.StatusServiceUnavailable {
+		t.Errorf("before the first report: got %d, want 503", code)
+	}
+	if code, _ := fetch("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz before the first report: got %d, want 503", code)
+	}
+	page := []byte("<html>report</html>")
+	current.Store(&servedReport{page: page, generated: time.Now()})
+	if code, body := fetch("/"); code != http.StatusOK || body != string(page) {
+		t.Errorf("got %d %q", code, body)
+	}
+	if code, body := fetch("/healthz"); code != http.StatusOK || !strings.Contains(body, `"ok":true`) {
+		t.Errorf("healthz: got %d %q", code, body)
+	}
+	current.Store(&servedReport{page: page, generated: time.Now().Add(-2 * time.Hour)})
+	if code, _ := fetch("/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz with a stale report: got %d, want 503", code)
+	}
+	if code, _ := fetch("/other"); code != http.StatusNotFound {
+		t.Errorf("unknown path: got %d, want 404", code)
+	}
+}
+
+func TestTimeoutFlag(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30", 30 * time.Second, false},
+		{"45s", 45 * time.Second, false},
+		{"2m", 2 * time.Minute, false},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		var timeout time.Duration
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Var((*secondsFlag)(&timeout), "timeout", "")
+		err := fs.Parse([]string{"--timeout", tt.arg})
+		if (err != nil) != tt.wantErr || timeout != tt.want {
+			t.Errorf("--timeout %s: got %s, %v; want %s (error %v)", tt.arg, timeout, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSetBugzillaSite(t *testing.T) {
+	oldBase := bugzillaBase
+	defer func() { bugzillaBase = oldBase }()
+
+	if got := showBugURL(1234); got != "https://bugzilla.mozilla.org/show_bug.cgi?id=1234" {
+		t.Errorf("default link: got %q", got)
+	}
+	if err := setBugzillaSite("https://bugzilla-dev.allizom.org/"); err != nil {
+		t.Fatal(err)
+	}
+	if bugzillaBase != "https://bugzilla-dev.allizom.org/rest/bug" {
+		t.Errorf("got base %q", bugzillaBase)
+	}
+	if got := showBugURL(1234); got != "https://bugzilla-dev.allizom.org/show_bug.cgi?id=1234" {
+		t.Errorf("staging link: got %q", got)
+	}
+	for _, bad := range []string{"bugzilla-dev.allizom.org", "ftp://bugzilla-dev.allizom.org", "https://"} {
+		if err := setBugzillaSite(bad); err == nil {
+			t.Errorf("setBugzillaSite(%q): expected error", bad)
+		}
+	}
+}
+
+func TestEmailMessage(t *testing.T) {
+	msg := string(emailMessage("perf@example.com", []string{"a@example.com", "b@example.com"},
+		"PerfTest triage report 2026-03-19", []byte("<html>report</html>")))
+	head, body, ok := strings.Cut(msg, "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no header/body separator in %q", msg)
+	}
+	for _, want := range []string{
+		"From: perf@example.com\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: PerfTest triage report 2026-03-19\r\n",
+		"Content-Type: text/html; charset=utf-8",
+	} {
+		if !strings.Contains(head+"\r\n", want) {
+			t.Errorf("missing header %q in %q", want, head)
+		}
+	}
+	if body != "<html>report</html>" {
+		t.Errorf("got body %q", body)
+	}
+}
+
+func TestBrowserCommand(t *testing.T) {
+	tests := []struct {
+		openWith, goos string
+		want           []string
+	}{
+		{"", "linux", []string{"xdg-open", "report.html"}},
+		{"", "darwin", []string{"open", "report.html"}},
+		{"firefox", "linux", []string{"firefox", "report.html"}},
+		{"firefox --new-tab", "darwin", []string{"firefox", "--new-tab", "report.html"}},
+	}
+	for _, tt := range tests {
+		cmd := browserCommand("report.html", false, tt.openWith, tt.goos)
+		if cmd == nil || !slices.Equal(cmd.Args, tt.want) {
+			t.Errorf("%q on %s: got %v, want %v", tt.openWith, tt.goos, cmd, tt.want)
+		}
+	}
+	if cmd := browserCommand("report.html", false, "", "plan9"); cmd != nil {
+		t.Errorf("plan9: got %v, want no opener", cmd.Args)
+	}
+}
+
+func TestFailingOver(t *testing.T) {
+	results := []Result{{ID: 1, NumberFailures: 120}, {ID: 2, NumberFailures: 100}, {ID: 3, NumberFailures: 99}}
+	if got := failingOver(results, 100); !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("got %v, want [1 2]", got)
+	}
+	if got := failingOver(results, 0); got != nil {
+		t.Errorf("disabled: got %v, want none", got)
+	}
+}
+
+func TestAutoCommentCandidates(t *testing.T) {
+	oldThreshold := threshold
+	threshold = 20
+	defer func() { threshold = oldThreshold }()
+
+	results := []Result{
+		{ID: 1, NumberFailures: 40},
+		{ID: 2, NumberFailures: 40, Assignee: "dev@mozilla.com"},
+		{ID: 3, NumberFailures: 40, Needinfo: "lead@mozilla.com"},
+		{ID: 4, NumberFailures: 5},
+	}
+	got := autoCommentCandidates(results)
+	if len(got) != 1 || got[0].ID != 1 {
+		t.Errorf("got %+v, want only bug 1", got)
+	}
+}
+
+func TestAutoCommentBugsOnce(t *testing.T) {
+	var mu sync.Mutex
+	comments := map[string][]map[string]string{}
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/rest/bug/"), "/comment")
+		if r.Method == http.MethodPost {
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			comments[id] = append(comments[id], map[string]string{"text": body["comment"]})
+			posts++
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": 1}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"bugs": map[string]any{id: map[string]any{"comments": comments[id]}}})
+	}))
+	defer server.Close()
+
+	oldBase, oldKey, oldThreshold := bugzillaBase, bugzillaAPIKey, threshold
+	bugzillaBase, bugzillaAPIKey, threshold = server.URL+"/rest/bug", "secret", 20
+	defer func() { bugzillaBase, bugzillaAPIKey, threshold = oldBase, oldKey, oldThreshold }()
+
+	results := []Result{{ID: 1, NumberFailures: 40}, {ID: 2, NumberFailures: 40}}
+	comments["2"] = []map[string]string{{"text": "Filed by treeherder"}}
+	autoCommentBugs(results, true)
+	if posts != 2 {
+		t.Fatalf("first run: got %d posts, want 2", posts)
+	}
+	autoCommentBugs(results, true)
+	if posts != 2 {
+		t.Errorf("second run posted %d more comments, want none", posts-2)
+	}
+}
+
+func TestPostBugComment(t *testing.T) {
+	var gotPath, gotKey string
+	var gotBody map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("X-BUGZILLA-API-KEY")
+		if err := json.NewDecoder(r.Body).Decode(&gotBody); err != nil {
+			t.Errorf("decode body: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 99}`))
+	}))
+	defer server.Close()
+
+	oldBase, oldKey := bugzillaBase, bugzillaAPIKey
+	bugzillaBase, bugzillaAPIKey = server.URL+"/rest/bug", "secret"
+	defer func() { bugzillaBase, bugzillaAPIKey = oldBase, oldKey }()
+
+	r := Result{ID: 1234, NumberFailures: 42, Component: "Raptor", WindowStart: "2026-03-12", WindowEnd: "2026-03-19"}
+	if err := postBugComment(r.ID, triageComment(r)); err != nil {
+		t.Fatal(err)
+	}
+	if gotPath != "/rest/bug/1234/comment" || gotKey != "secret" {
+		t.Errorf("got path %q, key %q", gotPath, gotKey)
+	}
+	if !strings.Contains(gotBody["comment"], "failed 42 times between 2026-03-12 and 2026-03-19") {
+		t.Errorf("got comment %q", gotBody["comment"])
+	}
+}
+
+func TestParseComponents(t *testing.T) {
+	input := "# cross-team sweep\nRaptor\n\n  Performance Engineering  \nTalos\nRaptor\n"
+	got, err := parseComponents(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"Raptor", "Performance Engineering", "Talos"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseNotes(t *testing.T) {
+	input := "# triage notes\n1234 waiting on vendor\n5678   WIP patch in review \n1234 vendor replied\n"
+	notes, err := parseNotes(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseNotes: %v", err)
+	}
+	if notes[1234] != "vendor replied" {
+		t.Errorf("bug 1234: got %q, want last note to win", notes[1234])
+	}
+	if notes[5678] != "WIP patch in review" {
+		t.Errorf("bug 5678: got %q", notes[5678])
+	}
+	if _, err := parseNotes(strings.NewReader("bug1234 note\n")); err == nil {
+		t.Error("expected error for non-numeric bug ID")
+	}
+}
+
+func TestFetchTreeherderCountsSelectedTrees(t *testing.T) {
+	perTree := map[string]string{
+		"autoland":        `[{"bug_id": 1234, "bug_count": 10}, {"bug_id": 5678, "bug_count": 1}]`,
+		"mozilla-central": `[{"bug_id": 1234, "bug_count": 5}]`,
+	}
+	var trees []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tree := r.URL.Query().Get("tree")
+		trees = append(trees, tree)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(perTree[tree]))
+	}))
+	defer server.Close()
+
+	old := treeherderBase
+	treeherderBase = server.URL
+	defer func() { treeherderBase = old }()
+	oldTrees := countTrees
+	countTrees = []string{"autoland", "mozilla-central"}
+	defer func() { countTrees = oldTrees }()
+
+	counts, err := fetchTreeherderCounts("2026-03-12", "2026-03-19")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[1234] != 15 || counts[5678] != 1 {
+		t.Errorf("got %v, want 1234:15 5678:1", counts)
+	}
+	if strings.Join(trees, ",") != "autoland,mozilla-central" {
+		t.Errorf("queried trees %v, want autoland and mozilla-central only", trees)
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	tests := []struct {
+		output, format string
+		asGiven        bool
+		want           string
+	}{
+		{"report.html", "html", false, "report.html"},
+		{"report.html", "json", false, "report.json"},
+		{"out/triage-2026-03", "gfm", false, "out/triage-2026-03.md"},
+		{"/tmp/weekly.report.html", "json", false, "/tmp/weekly.report.json"},
+		// an explicit --output is kept for the first format
+		{"report.htm", "html", true, "report.htm"},
+		{"weekly.v2", "html", true, "weekly.v2"},
+		{"report.htm", "json", false, "report.json"},
+		{"weekly.v2", "json", false, "weekly.v2.json"},
+	}
+	for _, tt := range tests {
+		if got := outputPath(tt.output, tt.format, tt.asGiven); got != tt.want {
+			t.Errorf("outputPath(%q, %q, %v) = %q, want %q", tt.output, tt.format, tt.asGiven, got, tt.want)
+		}
+	}
+}
+
+func TestGzipJSONReport(t *testing.T) {
+	gzipJSON = true
+	defer func() { gzipJSON = false }()
+
+	if got := outputPath("report.html", "json", false); got != "report.json.gz" {
+		t.Errorf("gzipped json path = %q, want report.json.gz", got)
+	}
+	if got := outputPath("weekly.json.gz", "md", false); got != "weekly.markdown" {
+		t.Errorf("markdown path beside weekly.json.gz = %q, want weekly.markdown", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json.gz")
+	if err := writeJSONReport(path, []Result{{ID: 1234, NumberFailures: 42}}, nil, nil); err != nil {
+		t.Fatalf("writeJSONReport failed: %v", err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("report is not gzipped: %v", err)
+	}
+	var report jsonReport
+	if err := json.NewDecoder(gz).Decode(&report); err != nil {
+		t.Fatalf("decoding the gzipped report failed: %v", err)
+	}
+	if len(report.Results) != 1 || report.Results[0].ID != 1234 {
+		t.Errorf("results = %+v, want bug 1234", report.Results)
+	}
+}
+
+func TestRenderGFM(t *testing.T) {
+	oldDays := daysBack
+	daysBack = 7
+	defer func() { daysBack = oldDays }()
+
+	var buf bytes.Buffer
+	err := renderGFM(&buf, []Result{{
+		ID: 1234, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=1234",
+		Summary:        "Intermittent raptor | browsertime timeout",
+		NumberFailures: 42, GraphLink: "https://treeherder.example/graph",
+		Platforms: []PlatformCount{{"linux1804", 40}, {"windows11", 2}},
+		Assignee:  "dev@mozilla.com",
+	}})
+	if err != nil {
+		t.Fatalf("renderGFM failed: %v", err)
+	}
+	out := buf.String()
+	want := "| [1234](https://bugzilla.mozilla.org/show_bug.cgi?id=1234) | Intermittent raptor \\| browsertime timeout | " +
+		"[42](https://treeherder.example/graph) | linux1804: 40, windows11: 2 | dev@mozilla.com |  |\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("expected row %q in output:\n%s", want, out)
+	}
+	if !strings.HasPrefix(out, "## Intermittent Failures (7d)") {
+		t.Errorf("unexpected heading:\n%s", out)
+	}
+}
+
+func TestRenderJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := renderJSON(&buf, jsonReport{
+		DaysBack: 7,
+		Results: []Result{{ID: 1234, NumberFailures: 42, GraphLink: "https://treeherder.example/graph",
+			BreakdownList: []string{"autoland: 42"}}},
+		Permas: []PermaBug{{ID: 5678, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=5678"}},
+	})
+	if err != nil {
+		t.Fatalf("renderJSON failed: %v", err)
+	}
+
+	var got jsonReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if len(got.Results) != 1 || got.Results[0].GraphLink != "https://treeherder.example/graph" || got.Results[0].BreakdownList[0] != "autoland: 42" {
+		t.Errorf("results did not round-trip: %+v", got.Results)
+	}
+	if len(got.Permas) != 1 || got.Permas[0].Link == "" {
+		t.Errorf("permas did not round-trip: %+v", got.Permas)
+	}
+}
+
+func TestRenderJSONPretty(t *testing.T) {
+	defer func() { prettyJSON = false }()
+	report := jsonReport{DaysBack: 7, Results: []Result{{ID: 1234}}}
+
+	var compact bytes.Buffer
+	if err := renderJSON(&compact, report); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(compact.String(), "\n"); lines != 1 {
+		t.Errorf("default output spans %d lines, want one compact line", lines)
+	}
+
+	prettyJSON = true
+	var pretty bytes.Buffer
+	if err := renderJSON(&pretty, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(pretty.String(), "\n  \"days_back\": 7,") {
+		t.Errorf("--pretty output is not indented:\n%s", pretty.String())
+	}
+	var a, b jsonReport
+	if json.Unmarshal(compact.Bytes(), &a) != nil || json.Unmarshal(pretty.Bytes(), &b) != nil || a.DaysBack != b.DaysBack {
+		t.Error("compact and pretty output should decode to the same report")
+	}
+}
+
+func TestRenderFromJSON(t *testing.T) {
+	oldDays, oldThreshold := daysBack, threshold
+	defer func() { daysBack, threshold = oldDays, oldThreshold; resetRun() }()
+	daysBack, threshold = 14, 30
+
+	dir := t.TempDir()
+	jsonPath, htmlPath := filepath.Join(dir, "report.json"), filepath.Join(dir, "report.html")
+	results := []Result{{ID: 1234, NumberFailures: 42, Summary: "Intermittent raptor-tp6 timeout", Component: "Raptor",
+		Platforms: []PlatformCount{{"linux1804", 42}}, BreakdownList: []string{"autoland: 42"}}}
+	permas := []PermaBug{{ID: 5678, Summary: "Perma talos-g5 crash", Component: "Talos"}}
+	if err := writeJSONReport(jsonPath, results, permas, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	daysBack, threshold = 7, 20
+	if err := renderFromJSON(jsonPath, htmlPath); err != nil {
+		t.Fatal(err)
+	}
+	if daysBack != 14 || threshold != 30 {
+		t.Errorf("settings not restored: days %d, threshold %d", daysBack, threshold)
+	}
+	data, err := os.ReadFile(htmlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+	for _, want := range []string{"Intermittent raptor-tp6 timeout", "Perma talos-g5 crash", "linux1804: 42", "autoland: 42"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("rendered report is missing %q", want)
+		}
+	}
+}
+
+func TestJSONKeysSnakeCase(t *testing.T) {
+	var buf bytes.Buffer
+	err := renderJSON(&buf, jsonReport{
+		Results:     []Result{{ID: 1234, NumberFailures: 42, QAContact: "qa@example.com", AboveP90: true, Platforms: []PlatformCount{{"linux1804", 42}}}},
+		Permas:      []PermaBug{{ID: 5678, TwoDayFailures: 3}},
+		TaskTimeout: &TaskTimeoutReport{PerfFailures: 7},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, key := range []string{`"days_back"`, `"number_failures"`, `"qa_contact"`, `"above_p90"`, `"two_day_failures"`, `"perf_failures"`, `"name"`} {
+		if !strings.Contains(out, key) {
+			t.Errorf("missing key %s in %s", key, out)
+		}
+	}
+	if regexp.MustCompile(`"[A-Z]\w*":`).MatchString(out) {
+		t.Errorf("CamelCase key in %s", out)
+	}
+
+	// reports written before the tags still load for --compare
+	legacy := `{"results":[{"ID":1,"NumberFailures":30,"TwoDayPlatforms":["linux1804: 2"]}],"permas":[{"ID":2,"TwoDayFailures":4}]}`
+	report, err := parseReport(strings.NewReader(legacy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := report.Results[0]; r.ID != 1 || r.NumberFailures != 30 || len(r.TwoDayPlatforms) != 1 || r.TwoDayPlatforms[0] != (PlatformCount{"linux1804", 2}) {
+		t.Errorf("legacy result: got %+v", r)
+	}
+	if p := report.Permas[0]; p.ID != 2 || p.TwoDayFailures != 4 {
+		t.Errorf("legacy perma: got %+v", p)
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	prior := []Result{
+		{ID: 1, NumberFailures: 30},
+		{ID: 2, NumberFailures: 50},
+		{ID: 3, NumberFailures: 25, Summary: "Fixed last week"},
+	}
+	results := []Result{
+		{ID: 1, NumberFailures: 45},
+		{ID: 2, NumberFailures: 20},
+		{ID: 4, NumberFailures: 22},
+	}
+
+	resolved := compareResults(results, prior)
+	if results[0].Delta != 15 || results[1].Delta != -30 || results[0].New || results[1].New {
+		t.Errorf("deltas: got %+d and %+d", results[0].Delta, results[1].Delta)
+	}
+	if !results[2].New || !results[2].Compared {
+		t.Errorf("bug 4 should be new, got %+v", results[2])
+	}
+	if len(resolved) != 1 || resolved[0].ID != 3 {
+		t.Errorf("resolved: got %+v, want bug 3", resolved)
+	}
+}
+
+func TestPostGitHubComment(t *testing.T) {
+	var posted []string
+	status, header := http.StatusCreated, http.Header{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/mozilla/perf-triage/issues/42/comments" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var payload map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("bad comment body: %v", err)
+		}
+		posted = append(posted, payload["body"])
+		maps.Copy(w.Header(), header)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	oldAPI := githubAPI
+	githubAPI = server.URL
+	defer func() { githubAPI = oldAPI }()
+
+	results := []Result{{ID: 1234, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=1234", Summary: "raptor timeout", NumberFailures: 42}}
+	if err := postGitHubComment("mozilla/perf-triage", 42, "secret", results); err != nil {
+		t.Fatalf("postGitHubComment failed: %v", err)
+	}
+	if len(posted) != 1 || !strings.Contains(posted[0], "| [1234](https://bugzilla.mozilla.org/show_bug.cgi?id=1234) | raptor timeout |") {
+		t.Errorf("comment should be the GFM table, got %q", posted)
+	}
+
+	// nothing to report posts nothing unless forced
+	notifyGitHub("mozilla/perf-triage", 42, "secret", nil, false)
+	if len(posted) != 1 {
+		t.Errorf("an empty run posted a comment without --github-force")
+	}
+	notifyGitHub("mozilla/perf-triage", 42, "secret", nil, true)
+	if len(posted) != 2 {
+		t.Errorf("--github-force should post even an empty run")
+	}
+
+	tests := []struct {
+		status int
+		header http.Header
+		want   string
+	}{
+		{http.StatusUnauthorized, nil, "rejected the token"},
+		{http.StatusForbidden, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1767225600"}}, "rate limit reached (403 Forbidden); retry after 2026-01-01T00:00:00Z"},
+		{http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}, "retry after 1m0s"},
+		{http.StatusForbidden, nil, "lack permission"},
+	}
+	for _, tt := range tests {
+		status, header = tt.status, tt.header
+		err := postGitHubComment("mozilla/perf-triage", 42, "secret", results)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("status %d: err = %v, want it to mention %q", tt.status, err, tt.want)
+		}
+	}
+}
+
+func TestPostSlack(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("bad webhook body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	results := []Result{
+		{ID: 1, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=1", Summary: "raptor <tp6> timeout", NumberFailures: 50},
+		{ID: 2, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=2", Summary: "talos crash", NumberFailures: 30},
+		{ID: 3, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=3", Summary: "awsy leak", NumberFailures: 21},
+	}
+	if err := postSlack(server.URL, results, 2); err != nil {
+		t.Fatalf("postSlack failed: %v", err)
+	}
+	text := payload["text"]
+	for _, want := range []string{
+		"<https://bugzilla.mozilla.org/show_bug.cgi?id=1|Bug 1> raptor &lt;tp6&gt; timeout — *50* failures",
+		"<https://bugzilla.mozilla.org/show_bug.cgi?id=2|Bug 2>",
+		"…and 1 more",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in message:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Bug 3>") {
+		t.Errorf("only the top 2 bugs should be listed:\n%s", text)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	oldDays := daysBack
+	daysBack = 7
+	defer func() { daysBack = oldDays }()
+
+	var buf bytes.Buffer
+	err := renderMarkdown(&buf, []Result{{
+		ID: 1234, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=1234",
+		Summary: "Intermittent raptor_tp6 [timeout]", NumberFailures: 42,
+		Platforms: []PlatformCount{{"linux1804", 40}, {"windows11", 2}}, BreakdownList: []string{"autoland: 42"},
+	}}, []PermaBug{{ID: 5678, Link: "https://bugzilla.mozilla.org/show_bug.cgi?id=5678", Summary: "Perma talos failure", NumberFailures: 9}})
+	if err != nil {
+		t.Fatalf("renderMarkdown failed: %v", err)
+	}
+	want := "## Intermittent Failures (7d)\n\n" +
+		"- [Bug 1234](https://bugzilla.mozilla.org/show_bug.cgi?id=1234) - Intermittent raptor\\_tp6 \\[timeout\\]: **42** failures\n" +
+		"    - Platforms:\n" +
+		"        - linux1804: 40\n" +
+		"        - windows11: 2\n" +
+		"    - Repository breakdown:\n" +
+		"        - autoland: 42\n" +
+		"\n## Perma Failures (7d)\n\n" +
+		"- [Bug 5678](https://bugzilla.mozilla.org/show_bug.cgi?id=5678) - Perma talos failure: **9** failures\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestUploadReport(t *testing.T) {
+	var gotMethod, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		if r.URL.Query().Get("X-Amz-Signature") == "bad" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "report.html")
+	if err := os.WriteFile(path, []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := uploadReport(path, server.URL+"/report.html?X-Amz-Signature=ok"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotMethod != http.MethodPut || gotBody != "<html></html>" {
+		t.Errorf("got %s with body %q", gotMethod, gotBody)
+	}
+	if err := uploadReport(path, server.URL+"/report.html?X-Amz-Signature=bad"); err == nil {
+		t.Error("expected error for 403 response")
+	}
+	if err := uploadReport(path, "s3://bucket/report.html"); err == nil {
+		t.Error("expected error for s3:// destination")
+	}
+}
+
+func TestPrintExamples(t *testing.T) {
+	var buf bytes.Buffer
+	printExamples(&buf)
+	out := buf.String()
+	if strings.Count(out, "go run main.go ") != len(examples) {
+		t.Errorf("expected one command line per example:\n%s", out)
+	}
+	if !strings.Contains(out, "--threshold 50") {
+		t.Errorf("expected threshold example in:\n%s", out)
+	}
+
+	// flags are registered inside main, so collect their names from the source
+	registered := map[string]bool{}
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "flag" {
+			return true
+		}
+		nameArg := 0
+		if strings.HasSuffix(sel.Sel.Name, "Var") {
+			nameArg = 1
+		}
+		if len(call.Args) > nameArg {
+			if lit, ok := call.Args[nameArg].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				registered[strings.Trim(lit.Value, `"`)] = true
+			}
+		}
+		return true
+	})
+	for _, ex := range examples {
+		for _, arg := range strings.Fields(ex.Args) {
+			if name, ok := strings.CutPrefix(arg, "--"); ok && !registered[strings.SplitN(name, "=", 2)[0]] {
+				t.Errorf("example %q uses unknown flag %s", ex.Desc, arg)
+			}
+		}
+	}
+}